@@ -10,6 +10,243 @@ import (
 	cli "github.com/urfave/cli/v2"
 )
 
+var modeFlag = &cli.StringFlag{
+	Name:     "mode",
+	Value:    "local",
+	Usage:    "`local` (default) runs your test on a BQ emulator. 'cloud': runs your queries on BigQuery, see --project",
+	Required: false,
+}
+
+var projectFlag = &cli.StringFlag{
+	Name:     "project",
+	Usage:    "Google Cloud project running the queries in cloud mode, credentials come from Application Default Credentials",
+	Required: false,
+}
+
+var locationFlag = &cli.StringFlag{
+	Name:     "location",
+	Usage:    "BigQuery location of the queries in cloud mode, e.g. `EU`",
+	Required: false,
+}
+
+var endpointFlag = &cli.StringFlag{
+	Name:     "endpoint",
+	Usage:    "overrides the BigQuery API URL in cloud mode, e.g. to test against a local stand-in server",
+	Required: false,
+}
+
+var maxBytesFlag = &cli.Int64Flag{
+	Name:     "max-bytes-processed",
+	Value:    0,
+	Usage:    "most bytes a query may scan in cloud mode according to its dry run, mocked queries scan none",
+	Required: false,
+}
+
+var nullMarkerFlag = &cli.StringFlag{
+	Name:     "null-marker",
+	Usage:    "value meaning NULL in mocks and outputs that do not set their own null_marker, empty values then are empty strings",
+	Required: false,
+}
+
+var parallelFlag = &cli.IntFlag{
+	Name:     "parallel",
+	Value:    1,
+	Usage:    "number of tests to run at the same time, each on its own emulator in local mode; in cloud mode the queries in flight, shared by the tests and their assertion queries",
+	Required: false,
+}
+
+var formatFlag = &cli.StringFlag{
+	Name:     "format",
+	Value:    "text",
+	Usage:    "`text` (default) prints colored results, 'json' prints the results as JSON",
+	Required: false,
+}
+
+var reportFlag = &cli.StringFlag{
+	Name:     "report",
+	Usage:    "writes a report of the test results, supported formats: `junit`",
+	Required: false,
+}
+
+var reportFileFlag = &cli.StringFlag{
+	Name:     "report-file",
+	Value:    "bqt-report.xml",
+	Usage:    "path of the report written by --report",
+	Required: false,
+}
+
+var manifestFlag = &cli.StringFlag{
+	Name:     "dbt-manifest",
+	Usage:    "`path` of the manifest.json of a dbt project, tests declaring a model run its SQL",
+	Required: false,
+}
+
+var watchFlag = &cli.BoolFlag{
+	Name:     "watch",
+	Usage:    "keeps running, and re-runs the tests whose YAML, SQL or CSV files change",
+	Required: false,
+}
+
+var runFilterFlag = &cli.StringFlag{
+	Name:     "run",
+	Usage:    "only runs the tests whose name matches the `regexp`",
+	Required: false,
+}
+
+var excludeFlag = &cli.StringSliceFlag{
+	Name:     "exclude",
+	Usage:    "skips the test definitions whose path, or one of its folders, matches the `glob`, can be repeated",
+	Required: false,
+}
+
+var tagsFlag = &cli.StringSliceFlag{
+	Name:     "tags",
+	Usage:    "only runs the tests with one of the tags, can be repeated or comma separated",
+	Required: false,
+}
+
+var skipTagsFlag = &cli.StringSliceFlag{
+	Name:     "skip-tags",
+	Usage:    "skips the tests with one of the tags, can be repeated or comma separated",
+	Required: false,
+}
+
+var runFlags = []cli.Flag{
+	modeFlag,
+	projectFlag,
+	locationFlag,
+	endpointFlag,
+	maxBytesFlag,
+	nullMarkerFlag,
+	parallelFlag,
+	formatFlag,
+	reportFlag,
+	reportFileFlag,
+	manifestFlag,
+	watchFlag,
+	runFilterFlag,
+	excludeFlag,
+	tagsFlag,
+	skipTagsFlag,
+}
+
+// Writes the report requested with --report, if any
+func writeReport(opts options, results []test.TestResult) error {
+	if opts.report == "" {
+		return nil
+	}
+	if err := test.WriteReport(opts.report, opts.reportFile, results); err != nil {
+		return fmt.Errorf("failed to write %v report: %w", opts.report, err)
+	}
+	fmt.Fprintln(os.Stderr, "Report written to:", opts.reportFile)
+	return nil
+}
+
+/*
+Sets the SQL of the tests declaring a dbt model from --dbt-manifest and renders every templated query,
+ref and source then resolve to the relations of the manifest
+*/
+func resolveModels(cCtx *cli.Context, tests []test.Test) error {
+	path := cCtx.String("dbt-manifest")
+	if path == "" {
+		for _, t := range tests {
+			if t.Model != "" {
+				return fmt.Errorf("test %v declares the dbt model %v, set --dbt-manifest", t.Name, t.Model)
+			}
+		}
+		return test.RenderTemplates(tests, nil)
+	}
+	manifest, err := test.LoadManifest(path)
+	if err != nil {
+		return err
+	}
+	if err := test.ResolveModels(tests, manifest); err != nil {
+		return err
+	}
+	return test.RenderTemplates(tests, manifest.TemplateFuncs())
+}
+
+// Writes a test definition to fill in for every model given as argument
+func scaffold(cCtx *cli.Context) error {
+	if cCtx.NArg() == 0 {
+		return fmt.Errorf("expected the name of at least one dbt model")
+	}
+	manifest, err := test.LoadManifest(cCtx.String("dbt-manifest"))
+	if err != nil {
+		return err
+	}
+	for _, model := range cCtx.Args().Slice() {
+		content, err := test.ScaffoldTest(manifest, model)
+		if err != nil {
+			return err
+		}
+		path, err := test.SaveScaffold(cCtx.String("out"), model, content)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(os.Stderr, "Scaffolded test:", path)
+	}
+	return nil
+}
+
+// Parses the tests found in the tests folder, keeps those selected by the filter flags and prepares their SQL
+func parseTests(cCtx *cli.Context, opts options) ([]test.Test, error) {
+	fmt.Fprintln(os.Stderr, "Parsing tests in directory:", opts.testsPath)
+	filter, err := test.NewFilter(cCtx.String("run"), cCtx.StringSlice("tags"), cCtx.StringSlice("skip-tags"))
+	if err != nil {
+		return nil, err
+	}
+	tests, err := test.ParseFolder(opts.testsPath, cCtx.StringSlice("exclude")...)
+	if err != nil {
+		return nil, err
+	}
+	tests = test.FilterTests(tests, filter)
+	if err := resolveModels(cCtx, tests); err != nil {
+		return nil, err
+	}
+	if len(opts.types) > 0 {
+		test.SetDefaultTypes(tests, opts.types)
+	}
+	if opts.nullMarker != nil {
+		test.SetNullMarker(tests, *opts.nullMarker)
+	}
+	return tests, nil
+}
+
+/*
+Parses and runs the tests found in testsPath and prints their results in the requested format.
+An empty testsPath means the tests folder of bqt.yaml, or else defaultTestsPath.
+Progress messages go to stderr so the results on stdout can be piped
+*/
+func run(cCtx *cli.Context, testsPath string, defaultTestsPath string) error {
+	opts, err := loadOptions(cCtx, testsPath, defaultTestsPath)
+	if err != nil {
+		return err
+	}
+
+	if cCtx.Bool("watch") {
+		return watch(cCtx, opts)
+	}
+
+	tests, err := parseTests(cCtx, opts)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(os.Stderr, "Parsed Tests:", len(tests))
+	fmt.Fprintln(os.Stderr, "Running Tests...")
+	results, err := test.RunTests(opts.config, tests)
+	if err != nil {
+		return err
+	}
+	if err := test.Render(opts.format, os.Stdout, results); err != nil {
+		return err
+	}
+	if err := writeReport(opts, results); err != nil {
+		return err
+	}
+	return test.Failures(results)
+}
+
 func main() {
 	app := &cli.App{
 		Name:  "bqt",
@@ -17,43 +254,37 @@ func main() {
 		UsageText: `bqt [options] [test directory]
 
 	EXAMPLES:
-  # Run tests in current directory
+  # Run tests in the tests folder of bqt.yaml, or else the current directory
   bqt
 
   # Run tests in specific directory
   bqt path/to/tests
 
   # Run tests using cloud mode
-  bqt --mode=cloud path/to/tests`,
-		Flags: []cli.Flag{
-			&cli.StringFlag{
-				Name:     "mode",
-				Value:    "local",
-				Usage:    "`local` (default) runs your test on a BQ emulator. 'cloud': runs your queries on the cloud (disabled)",
-				Required: false,
-			},
-		},
-		Action: func(cCtx *cli.Context) error {
-			// Default to current directory if no argument provided
-			testsPath := "."
-			if cCtx.NArg() > 0 {
-				testsPath = cCtx.Args().Get(0)
-			}
+  bqt --mode=cloud --project=my-project --location=EU path/to/tests
 
-			mode := cCtx.String("mode")
+  # Run 8 tests at a time
+  bqt --parallel 8 path/to/tests
 
-			fmt.Println("Parsing tests in directory:", testsPath)
-			tests, err := test.ParseFolder(testsPath)
-			if err != nil {
-				return err
-			}
-			fmt.Println("Parsed Tests:", len(tests))
-			fmt.Println("Running Tests...")
-			err = test.RunTests(mode, tests)
-			if err != nil {
-				return err
-			}
-			return nil
+  # Print the results as JSON
+  bqt --format json path/to/tests
+
+  # Write a JUnit XML report for CI
+  bqt --report junit --report-file report.xml path/to/tests
+
+  # Only run the tests of one model, skipping the slow ones
+  bqt --run '^orders/' --skip-tags slow path/to/tests
+
+  # Re-run the tests whose files change
+  bqt --watch path/to/tests
+
+  # Test the models of a dbt project, and scaffold a test for one of them
+  bqt --dbt-manifest target/manifest.json path/to/tests
+  bqt scaffold --dbt-manifest target/manifest.json --out path/to/tests orders`,
+		Flags: runFlags,
+		Action: func(cCtx *cli.Context) error {
+			// Default to the tests folder of bqt.yaml, or else the current directory, if no argument provided
+			return run(cCtx, cCtx.Args().Get(0), ".")
 		},
 	}
 
@@ -63,36 +294,41 @@ func main() {
 			Name:    "test",
 			Aliases: []string{"t"},
 			Usage:   "Run tests using a local BQ emulator",
-			Flags: []cli.Flag{
+			Flags: append([]cli.Flag{
 				&cli.StringFlag{
 					Name:     "tests",
 					Value:    "unit_tests/",
 					Usage:    "Path to your folder containing yaml test definitions",
 					Required: false,
 				},
+			}, runFlags...),
+			Action: func(cCtx *cli.Context) error {
+				testsPath := ""
+				if cCtx.IsSet("tests") {
+					testsPath = cCtx.String("tests")
+				}
+				return run(cCtx, testsPath, cCtx.String("tests"))
+			},
+		},
+		{
+			Name:      "scaffold",
+			Usage:     "Write a test definition for dbt models, with one mock per upstream relation",
+			ArgsUsage: "model [model...]",
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:     "dbt-manifest",
+					Value:    "target/manifest.json",
+					Usage:    "`path` of the manifest.json of the dbt project",
+					Required: false,
+				},
 				&cli.StringFlag{
-					Name:     "mode",
-					Value:    "local",
-					Usage:    "`local` (default) runs your test on a BQ emulator. 'cloud': runs your queries on the cloud (disabled)",
+					Name:     "out",
+					Value:    ".",
+					Usage:    "folder the test definitions are written to",
 					Required: false,
 				},
 			},
-			Action: func(cCtx *cli.Context) error {
-				mode := cCtx.String("mode")
-				testsPath := cCtx.String("tests")
-				fmt.Println("Parsing tests in directory:", testsPath)
-				tests, err := test.ParseFolder(testsPath)
-				if err != nil {
-					return err
-				}
-				fmt.Println("Parsed Tests:", len(tests))
-				fmt.Println("Running Tests...")
-				err = test.RunTests(mode, tests)
-				if err != nil {
-					return err
-				}
-				return nil
-			},
+			Action: scaffold,
 		},
 	}
 
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/JoseTorrado/bqt/internal/test"
+
+	cli "github.com/urfave/cli/v2"
+)
+
+// Settings of a run, a flag set on the command line wins over the bqt.yaml of the repository, which wins over the flag default
+type options struct {
+	config     test.RunConfig
+	testsPath  string
+	format     string
+	report     string
+	reportFile string
+	nullMarker *string
+	types      map[string]string
+}
+
+func stringOption(cCtx *cli.Context, flag string, configured string) string {
+	if cCtx.IsSet(flag) || configured == "" {
+		return cCtx.String(flag)
+	}
+	return configured
+}
+
+/*
+Merges the flags with the bqt.yaml found from the working directory upward.
+testsPath is the folder given on the command line, empty when none was, defaultTestsPath is used when neither sets it
+*/
+func loadOptions(cCtx *cli.Context, testsPath string, defaultTestsPath string) (options, error) {
+	wd, err := os.Getwd()
+	if err != nil {
+		return options{}, err
+	}
+	configured, err := test.DiscoverConfig(wd)
+	if err != nil {
+		return options{}, err
+	}
+	if configured.Path != "" {
+		fmt.Fprintln(os.Stderr, "Using configuration:", configured.Path)
+	}
+
+	opts := options{
+		config: test.RunConfig{
+			Mode:              stringOption(cCtx, "mode", configured.Mode),
+			Project:           stringOption(cCtx, "project", configured.Project),
+			Datasets:          configured.Datasets,
+			Location:          stringOption(cCtx, "location", configured.Location),
+			Endpoint:          cCtx.String("endpoint"),
+			Parallel:          cCtx.Int("parallel"),
+			MaxBytesProcessed: cCtx.Int64("max-bytes-processed"),
+		},
+		testsPath:  testsPath,
+		format:     stringOption(cCtx, "format", configured.Format),
+		report:     stringOption(cCtx, "report", configured.Report),
+		reportFile: stringOption(cCtx, "report-file", configured.ReportFile),
+		nullMarker: configured.NullMarker,
+		types:      configured.Types,
+	}
+	if !cCtx.IsSet("parallel") && configured.Parallel != 0 {
+		opts.config.Parallel = configured.Parallel
+	}
+	if !cCtx.IsSet("max-bytes-processed") && configured.MaxBytesProcessed != 0 {
+		opts.config.MaxBytesProcessed = configured.MaxBytesProcessed
+	}
+	if cCtx.IsSet("null-marker") {
+		marker := cCtx.String("null-marker")
+		opts.nullMarker = &marker
+	}
+	if opts.testsPath == "" {
+		opts.testsPath = configured.Tests
+	}
+	if opts.testsPath == "" {
+		opts.testsPath = defaultTestsPath
+	}
+
+	if opts.format != "text" && opts.format != "json" {
+		return options{}, fmt.Errorf("unsupported output format %q, expected text or json", opts.format)
+	}
+	if opts.config.Parallel < 1 {
+		return options{}, fmt.Errorf("--parallel must be at least 1, got %d", opts.config.Parallel)
+	}
+	return opts, nil
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/JoseTorrado/bqt/internal/test"
+
+	cli "github.com/urfave/cli/v2"
+)
+
+// How often watch mode checks the files of the tests for changes
+const watchInterval = 500 * time.Millisecond
+
+/*
+Runs every test once, then re-runs the tests whose files change until the process is interrupted.
+All runs share the emulators of a single runner. A test definition that fails to parse is reported and waits for the next change,
+the files of the last tests that parsed stay watched and the changes seen meanwhile are run once they parse again
+*/
+func watch(cCtx *cli.Context, opts options) error {
+	runner, err := test.NewRunner(opts.config)
+	if err != nil {
+		return err
+	}
+	defer runner.Close()
+
+	watcher := test.NewWatcher()
+	var tests []test.Test
+	pending := []string{}
+	first := true
+	for ; ; time.Sleep(watchInterval) {
+		files, err := test.WatchedFiles(opts.testsPath, tests)
+		if err != nil {
+			return err
+		}
+		changed := watcher.Changed(files)
+		if len(changed) == 0 {
+			continue
+		}
+
+		pending = append(pending, changed...)
+
+		parsed, err := parseTests(cCtx, opts)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			continue
+		}
+		affected := parsed
+		if !first {
+			affected = test.AffectedTests(parsed, pending)
+		}
+		pending = []string{}
+		// Newly referenced files are only known once the tests are parsed, start watching them now
+		if files, err := test.WatchedFiles(opts.testsPath, parsed); err == nil {
+			watcher.Add(files)
+		}
+		tests = parsed
+		first = false
+		if len(affected) == 0 {
+			continue
+		}
+
+		fmt.Fprintf(os.Stderr, "Running %d of %d tests...\n", len(affected), len(tests))
+		results := runner.Run(affected)
+		if err := test.Render(opts.format, os.Stdout, results); err != nil {
+			return err
+		}
+		if err := writeReport(opts, results); err != nil {
+			return err
+		}
+		if err := test.Failures(results); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		fmt.Fprintln(os.Stderr, "Watching for changes...")
+	}
+}
@@ -0,0 +1,192 @@
+package test
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Returns whether an error message contains the expected text or matches it as a regular expression
+func errorMatches(message string, expected string) bool {
+	if strings.Contains(message, expected) {
+		return true
+	}
+	pattern, err := regexp.Compile(expected)
+	return err == nil && pattern.MatchString(message)
+}
+
+// Returns the rows of actual with only the given columns, in that order
+func projectRows(columns []string, actual RowSet) ([][]string, error) {
+	indexes := map[string]int{}
+	for i, column := range actual.Columns {
+		indexes[column] = i
+	}
+	projected := [][]string{}
+	for _, row := range actual.Rows {
+		values := []string{}
+		for _, column := range columns {
+			i, ok := indexes[column]
+			if !ok {
+				return nil, fmt.Errorf("query output has no column %v", column)
+			}
+			values = append(values, row[i])
+		}
+		projected = append(projected, values)
+	}
+	return projected, nil
+}
+
+/*
+Returns whether an actual value matches the expected one and their difference when both are numbers.
+Values of columns without a tolerance, or that are not numbers, must be equal
+*/
+func valuesMatch(expected string, actual string, tolerance Tolerance, hasTolerance bool) (bool, float64, bool) {
+	e, expectedErr := strconv.ParseFloat(expected, 64)
+	a, actualErr := strconv.ParseFloat(actual, 64)
+	if !hasTolerance || expectedErr != nil || actualErr != nil {
+		return expected == actual, 0, false
+	}
+	delta := a - e
+	return math.Abs(delta) <= tolerance.Absolute || math.Abs(delta) <= tolerance.Relative*math.Abs(e), delta, true
+}
+
+func rowsMatch(columns []string, expected []string, actual []string, tolerances map[string]Tolerance) bool {
+	for i, column := range columns {
+		tolerance, hasTolerance := tolerances[column]
+		if ok, _, _ := valuesMatch(expected[i], actual[i], tolerance, hasTolerance); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+/*
+Compares the rows of the query with the expected ones position by position, on the expected columns only.
+Returns nil when they are equal
+*/
+func compareOrdered(expected RowSet, actual RowSet, tolerances map[string]Tolerance) (*OrderDiff, error) {
+	actualRows, err := projectRows(expected.Columns, actual)
+	if err != nil {
+		return nil, err
+	}
+	diff := OrderDiff{Columns: expected.Columns, Expected: expected.Rows, Actual: actualRows}
+	for i := 0; i < len(diff.Expected) || i < len(diff.Actual); i++ {
+		if i >= len(diff.Expected) || i >= len(diff.Actual) || !rowsMatch(diff.Columns, diff.Expected[i], diff.Actual[i], tolerances) {
+			diff.Position = i + 1
+			return &diff, nil
+		}
+	}
+	return nil, nil
+}
+
+/*
+Describes how far the closest actual row is from an expected row that found no match,
+the closest row is equal on every column without a tolerance and has the smallest total difference
+*/
+func closestDelta(columns []string, expected []string, actualRows [][]string, used []bool, tolerances map[string]Tolerance) string {
+	best := ""
+	bestDistance := math.Inf(1)
+	for j, actual := range actualRows {
+		if used[j] {
+			continue
+		}
+		distance := 0.0
+		deltas := []string{}
+		comparable := true
+		for i, column := range columns {
+			tolerance, hasTolerance := tolerances[column]
+			ok, delta, numeric := valuesMatch(expected[i], actual[i], tolerance, hasTolerance)
+			if !numeric {
+				if !ok {
+					comparable = false
+					break
+				}
+				continue
+			}
+			distance += math.Abs(delta)
+			if delta != 0 {
+				deltas = append(deltas, fmt.Sprintf("%s: %+g", column, delta))
+			}
+		}
+		if comparable && distance < bestDistance {
+			bestDistance = distance
+			best = strings.Join(deltas, ", ")
+		}
+	}
+	return best
+}
+
+/*
+Matches every expected row with a distinct actual row, numeric columns with a tolerance match when close enough.
+Returns the actual rows left unmatched and the expected rows that found no match, the latter with the delta to the closest actual row.
+As many rows as possible are matched: a row taking an actual row another one needs moves on to its other candidates
+*/
+func matchRows(expected RowSet, actual RowSet, tolerances map[string]Tolerance) (RowSet, RowSet, error) {
+	actualRows, err := projectRows(expected.Columns, actual)
+	if err != nil {
+		return RowSet{}, RowSet{}, err
+	}
+	outputColumns := map[string]bool{}
+	for _, column := range expected.Columns {
+		outputColumns[column] = true
+	}
+	for column := range tolerances {
+		if !outputColumns[column] {
+			return RowSet{}, RowSet{}, fmt.Errorf("tolerance set on column %v which is not in the output", column)
+		}
+	}
+
+	// Maximum bipartite matching with augmenting paths, matchedTo holds the expected row of each actual row or -1
+	candidates := make([][]int, len(expected.Rows))
+	for i, row := range expected.Rows {
+		for j, actualRow := range actualRows {
+			if rowsMatch(expected.Columns, row, actualRow, tolerances) {
+				candidates[i] = append(candidates[i], j)
+			}
+		}
+	}
+	matchedTo := make([]int, len(actualRows))
+	for j := range matchedTo {
+		matchedTo[j] = -1
+	}
+	var augment func(i int, visited []bool) bool
+	augment = func(i int, visited []bool) bool {
+		for _, j := range candidates[i] {
+			if visited[j] {
+				continue
+			}
+			visited[j] = true
+			if matchedTo[j] == -1 || augment(matchedTo[j], visited) {
+				matchedTo[j] = i
+				return true
+			}
+		}
+		return false
+	}
+	matched := make([]bool, len(expected.Rows))
+	for i := range expected.Rows {
+		matched[i] = augment(i, make([]bool, len(actualRows)))
+	}
+	used := make([]bool, len(actualRows))
+	for j, i := range matchedTo {
+		used[j] = i != -1
+	}
+
+	missing := RowSet{Columns: append(append([]string{}, expected.Columns...), "bqt_delta"), Rows: [][]string{}}
+	for i, row := range expected.Rows {
+		if !matched[i] {
+			delta := closestDelta(expected.Columns, row, actualRows, used, tolerances)
+			missing.Rows = append(missing.Rows, append(append([]string{}, row...), delta))
+		}
+	}
+
+	extra := RowSet{Columns: expected.Columns, Rows: [][]string{}}
+	for j, actualRow := range actualRows {
+		if !used[j] {
+			extra.Rows = append(extra.Rows, actualRow)
+		}
+	}
+	return extra, missing, nil
+}
@@ -0,0 +1,76 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompareOrdered(t *testing.T) {
+	expected := RowSet{Columns: []string{"id", "price"}, Rows: [][]string{{"2", "30"}, {"1", "12"}, {"3", "5"}}}
+	actual := RowSet{Columns: []string{"price", "id"}, Rows: [][]string{{"30", "2"}, {"12", "1"}, {"5", "3"}}}
+	diff, err := compareOrdered(expected, actual, nil)
+	assert.Nil(t, err)
+	assert.Nil(t, diff)
+
+	actual.Rows = [][]string{{"30", "2"}, {"5", "3"}, {"12", "1"}}
+	diff, err = compareOrdered(expected, actual, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, diff.Position)
+	assert.Equal(t, [][]string{{"2", "30"}, {"3", "5"}, {"1", "12"}}, diff.Actual)
+
+	actual.Rows = [][]string{{"30", "2"}, {"12", "1"}}
+	diff, err = compareOrdered(expected, actual, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, diff.Position)
+
+	_, err = compareOrdered(expected, RowSet{Columns: []string{"id"}, Rows: [][]string{{"2"}}}, nil)
+	assert.NotNil(t, err)
+}
+
+func TestCompareOrderedWithTolerance(t *testing.T) {
+	expected := RowSet{Columns: []string{"avg"}, Rows: [][]string{{"316.67"}, {"65"}}}
+	actual := RowSet{Columns: []string{"avg"}, Rows: [][]string{{"316.6666666666667"}, {"65"}}}
+	diff, err := compareOrdered(expected, actual, map[string]Tolerance{"avg": {Absolute: 0.01}})
+	assert.Nil(t, err)
+	assert.Nil(t, diff)
+
+	diff, err = compareOrdered(expected, actual, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, diff.Position)
+}
+
+func TestMatchRows(t *testing.T) {
+	expected := RowSet{Columns: []string{"category", "avg"}, Rows: [][]string{{"a", "100"}, {"b", "200"}, {"b", "200"}}}
+	actual := RowSet{Columns: []string{"avg", "category"}, Rows: [][]string{{"100.5", "a"}, {"201", "b"}, {"230", "b"}}}
+
+	extra, missing, err := matchRows(expected, actual, map[string]Tolerance{"avg": {Relative: 0.01}})
+	assert.Nil(t, err)
+	assert.Equal(t, [][]string{{"b", "230"}}, extra.Rows)
+	assert.Equal(t, []string{"category", "avg", "bqt_delta"}, missing.Columns)
+	assert.Equal(t, [][]string{{"b", "200", "avg: +30"}}, missing.Rows)
+
+	extra, missing, err = matchRows(expected, actual, map[string]Tolerance{"avg": {Absolute: 50}})
+	assert.Nil(t, err)
+	assert.Empty(t, extra.Rows)
+	assert.Empty(t, missing.Rows)
+
+	// 100 takes 100.9 first, 101 only matches 100.9 too, so 100 moves on to 99.5
+	expected = RowSet{Columns: []string{"avg"}, Rows: [][]string{{"100"}, {"101"}}}
+	actual = RowSet{Columns: []string{"avg"}, Rows: [][]string{{"100.9"}, {"99.5"}}}
+	extra, missing, err = matchRows(expected, actual, map[string]Tolerance{"avg": {Absolute: 1}})
+	assert.Nil(t, err)
+	assert.Empty(t, extra.Rows)
+	assert.Empty(t, missing.Rows)
+
+	_, _, err = matchRows(expected, actual, map[string]Tolerance{"price": {Absolute: 1}})
+	assert.NotNil(t, err)
+}
+
+func TestErrorMatches(t *testing.T) {
+	message := "BigQuery Syntax Error: negative amount for order 3"
+	assert.True(t, errorMatches(message, "negative amount"))
+	assert.True(t, errorMatches(message, `order \d+$`))
+	assert.False(t, errorMatches(message, "division by zero"))
+	assert.False(t, errorMatches(message, "amount ("))
+}
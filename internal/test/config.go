@@ -0,0 +1,107 @@
+package test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/goccy/go-yaml"
+)
+
+// Name of the configuration file of a repository, it is never parsed as a test definition
+const ConfigFileName = "bqt.yaml"
+
+/*
+Defaults of a repository, read from its bqt.yaml, flags set on the command line override them.
+Project and Datasets are created in the emulator in local mode, Project is the project running the queries in cloud mode.
+Tests is the folder of the test definitions, relative to the configuration file.
+Types are column types applied to every mock and output that does not declare the column itself
+*/
+type Config struct {
+	Path              string            `yaml:"-"`
+	Project           string            `yaml:"project"`
+	Datasets          []string          `yaml:"datasets"`
+	Location          string            `yaml:"location"`
+	Tests             string            `yaml:"tests"`
+	Mode              string            `yaml:"mode"`
+	NullMarker        *string           `yaml:"null_marker"`
+	Types             map[string]string `yaml:"types"`
+	Format            string            `yaml:"format"`
+	Report            string            `yaml:"report"`
+	ReportFile        string            `yaml:"report_file"`
+	Parallel          int               `yaml:"parallel"`
+	MaxBytesProcessed int64             `yaml:"max_bytes_processed"`
+}
+
+/*
+Returns the path of the bqt.yaml in dir or in the closest of its parent folders.
+Returns an empty path when there is none
+*/
+func FindConfig(dir string) (string, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	for {
+		path := filepath.Join(dir, ConfigFileName)
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", nil
+		}
+		dir = parent
+	}
+}
+
+func LoadConfig(path string) (Config, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return Config{}, err
+	}
+	config := Config{}
+	if err := yaml.UnmarshalWithOptions(content, &config, yaml.DisallowUnknownField()); err != nil {
+		return Config{}, fmt.Errorf("invalid configuration %v: %w", path, err)
+	}
+	config.Path = path
+	if config.Tests != "" && !filepath.IsAbs(config.Tests) {
+		config.Tests = filepath.Join(filepath.Dir(path), config.Tests)
+	}
+	return config, nil
+}
+
+// Loads the bqt.yaml found from dir upward, or returns an empty configuration when there is none
+func DiscoverConfig(dir string) (Config, error) {
+	path, err := FindConfig(dir)
+	if err != nil || path == "" {
+		return Config{}, err
+	}
+	return LoadConfig(path)
+}
+
+// Declares the default type of a column on every mock, output and target that neither types nor lists it in its schema
+func SetDefaultTypes(tests []Test, defaults map[string]string) {
+	withDefaults := func(m Mock) Mock {
+		types := map[string]string{}
+		for column, columnType := range defaults {
+			if _, ok := m.Schema[column]; !ok {
+				types[column] = columnType
+			}
+		}
+		for column, columnType := range m.Types {
+			types[column] = columnType
+		}
+		m.Types = types
+		return m
+	}
+	for i := range tests {
+		for table, mock := range tests[i].Mocks {
+			tests[i].Mocks[table] = withDefaults(mock)
+		}
+		tests[i].Output = withDefaults(tests[i].Output)
+		for table, target := range tests[i].Targets {
+			tests[i].Targets[table] = withDefaults(target)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiscoverConfig(t *testing.T) {
+	root := t.TempDir()
+	nested := filepath.Join(root, "models", "orders")
+	assert.Nil(t, os.MkdirAll(nested, os.ModePerm))
+
+	config, err := DiscoverConfig(nested)
+	assert.Nil(t, err)
+	assert.Equal(t, "", config.Path)
+
+	content := "project: my-project\ndatasets: [staging, marts]\ntests: unit_tests\nparallel: 4\nnull_marker: \\N\ntypes:\n  id: int64\n"
+	assert.Nil(t, os.WriteFile(filepath.Join(root, ConfigFileName), []byte(content), 0644))
+	config, err = DiscoverConfig(nested)
+	assert.Nil(t, err)
+	assert.Equal(t, filepath.Join(root, ConfigFileName), config.Path)
+	assert.Equal(t, "my-project", config.Project)
+	assert.Equal(t, []string{"staging", "marts"}, config.Datasets)
+	assert.Equal(t, filepath.Join(root, "unit_tests"), config.Tests)
+	assert.Equal(t, 4, config.Parallel)
+	assert.Equal(t, `\N`, *config.NullMarker)
+	assert.Equal(t, map[string]string{"id": "int64"}, config.Types)
+
+	assert.Nil(t, os.WriteFile(filepath.Join(root, ConfigFileName), []byte("paralel: 4\n"), 0644))
+	_, err = DiscoverConfig(nested)
+	assert.NotNil(t, err)
+}
+
+func TestSetDefaultTypes(t *testing.T) {
+	tests := []Test{{
+		Mocks: map[string]Mock{
+			"t": {Types: map[string]string{"id": "string"}},
+			"u": {Schema: map[string]string{"id": "float64"}},
+		},
+	}}
+	SetDefaultTypes(tests, map[string]string{"id": "int64", "day": "date"})
+	assert.Equal(t, map[string]string{"id": "string", "day": "date"}, tests[0].Mocks["t"].Types)
+	assert.Equal(t, map[string]string{"day": "date"}, tests[0].Mocks["u"].Types)
+	assert.Equal(t, map[string]string{"id": "int64", "day": "date"}, tests[0].Output.Types)
+}
@@ -0,0 +1,222 @@
+package test
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/goccy/go-yaml"
+)
+
+// The parts of a dbt manifest.json bqt reads
+type DbtManifest struct {
+	Nodes   map[string]DbtNode `json:"nodes"`
+	Sources map[string]DbtNode `json:"sources"`
+}
+
+/*
+A model, seed, snapshot or source of a dbt project.
+RelationName is the fully qualified table it is built into, e.g. `project`.`dataset`.`orders`.
+CompiledCode is only set once the project was compiled, RawCode is the templated SQL of the model.
+Manifests older than dbt 1.3 name them compiled_sql and raw_sql
+*/
+type DbtNode struct {
+	UniqueID     string `json:"unique_id"`
+	ResourceType string `json:"resource_type"`
+	Name         string `json:"name"`
+	SourceName   string `json:"source_name"`
+	PackageName  string `json:"package_name"`
+	RelationName string `json:"relation_name"`
+	RawCode      string `json:"raw_code"`
+	CompiledCode string `json:"compiled_code"`
+	RawSQL       string `json:"raw_sql"`
+	CompiledSQL  string `json:"compiled_sql"`
+	DependsOn    struct {
+		Nodes []string `json:"nodes"`
+	} `json:"depends_on"`
+	Columns map[string]struct {
+		Name     string `json:"name"`
+		DataType string `json:"data_type"`
+	} `json:"columns"`
+}
+
+func LoadManifest(path string) (DbtManifest, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return DbtManifest{}, err
+	}
+	manifest := DbtManifest{}
+	if err := json.Unmarshal(content, &manifest); err != nil {
+		return DbtManifest{}, fmt.Errorf("invalid dbt manifest %v: %w", path, err)
+	}
+	return manifest, nil
+}
+
+// Returns the model with the given name
+func (m DbtManifest) Model(name string) (DbtNode, error) {
+	for _, node := range m.Nodes {
+		if node.ResourceType == "model" && node.Name == name {
+			return node, nil
+		}
+	}
+	return DbtNode{}, fmt.Errorf("model %v is not part of the dbt manifest", name)
+}
+
+// Returns the node or source with the given unique id
+func (m DbtManifest) node(uniqueID string) (DbtNode, bool) {
+	if node, ok := m.Nodes[uniqueID]; ok {
+		return node, true
+	}
+	node, ok := m.Sources[uniqueID]
+	return node, ok
+}
+
+/*
+Returns the SQL of a model, its compiled code when the project was compiled.
+Otherwise its raw code, left to RenderTemplates with the functions of TemplateFuncs
+*/
+func (m DbtManifest) ModelSQL(name string) (string, error) {
+	model, err := m.Model(name)
+	if err != nil {
+		return "", err
+	}
+	for _, sql := range []string{model.CompiledCode, model.CompiledSQL, model.RawCode} {
+		if sql != "" {
+			return strings.TrimSpace(sql), nil
+		}
+	}
+	return strings.TrimSpace(model.RawSQL), nil
+}
+
+/*
+Template functions resolving ref and source to the relations of the manifest, for RenderTemplates.
+ref('package', 'model') picks the model of a package when several packages have a model of that name
+*/
+func (m DbtManifest) TemplateFuncs() template.FuncMap {
+	return template.FuncMap{
+		"ref": func(args ...string) (string, error) {
+			switch len(args) {
+			case 1:
+				node, err := m.Model(args[0])
+				if err != nil {
+					return "", err
+				}
+				return node.RelationName, nil
+			case 2:
+				for _, node := range m.Nodes {
+					if node.ResourceType == "model" && node.PackageName == args[0] && node.Name == args[1] {
+						return node.RelationName, nil
+					}
+				}
+				return "", fmt.Errorf("model %v.%v is not part of the dbt manifest", args[0], args[1])
+			}
+			return "", fmt.Errorf("ref takes a model and an optional package, got %d arguments", len(args))
+		},
+		"source": func(source string, table string) (string, error) {
+			for _, node := range m.Sources {
+				if node.SourceName == source && node.Name == table {
+					return node.RelationName, nil
+				}
+			}
+			return "", fmt.Errorf("source %v.%v is not part of the dbt manifest", source, table)
+		},
+	}
+}
+
+// Sets the SQL of every test declaring a dbt model to the SQL of the model in the manifest
+func ResolveModels(tests []Test, manifest DbtManifest) error {
+	for i := range tests {
+		if tests[i].Model == "" {
+			continue
+		}
+		sql, err := manifest.ModelSQL(tests[i].Model)
+		if err != nil {
+			return fmt.Errorf("test %v: %w", tests[i].Name, err)
+		}
+		tests[i].FileContent = sql
+	}
+	return nil
+}
+
+// The columns of a node as a schema, every column without a documented data type is a STRING
+func dbtSchema(node DbtNode) map[string]string {
+	if len(node.Columns) == 0 {
+		return nil
+	}
+	schema := map[string]string{}
+	for name, column := range node.Columns {
+		if column.DataType == "" {
+			schema[name] = "string"
+		} else {
+			schema[name] = column.DataType
+		}
+	}
+	return schema
+}
+
+// The header of a mock of a node, empty when its columns are not documented
+func dbtCsvHeader(node DbtNode) string {
+	if len(node.Columns) == 0 {
+		return ""
+	}
+	columns := []string{}
+	for name := range node.Columns {
+		columns = append(columns, name)
+	}
+	sort.Strings(columns)
+	return strings.Join(columns, ",") + "\n"
+}
+
+// The subset of a test definition written by ScaffoldTest
+type scaffoldMock struct {
+	Csv    string            `yaml:"csv"`
+	Schema map[string]string `yaml:"schema,omitempty"`
+}
+
+type scaffold struct {
+	Name   string                  `yaml:"name"`
+	Model  string                  `yaml:"model"`
+	Mocks  map[string]scaffoldMock `yaml:"mocks"`
+	Output scaffoldMock            `yaml:"output"`
+}
+
+/*
+Returns the YAML of a test for a model with one mock per upstream relation and an empty output, to fill in.
+The columns documented in the manifest become the header and schema of the mocks and output
+*/
+func ScaffoldTest(manifest DbtManifest, name string) ([]byte, error) {
+	model, err := manifest.Model(name)
+	if err != nil {
+		return nil, err
+	}
+	test := scaffold{
+		Name:   name,
+		Model:  name,
+		Mocks:  map[string]scaffoldMock{},
+		Output: scaffoldMock{Csv: dbtCsvHeader(model), Schema: dbtSchema(model)},
+	}
+	for _, uniqueID := range model.DependsOn.Nodes {
+		node, ok := manifest.node(uniqueID)
+		if !ok || node.RelationName == "" {
+			continue
+		}
+		test.Mocks[node.RelationName] = scaffoldMock{Csv: dbtCsvHeader(node), Schema: dbtSchema(node)}
+	}
+	return yaml.MarshalWithOptions(test, yaml.UseLiteralStyleIfMultiline(true))
+}
+
+// Writes a scaffolded test to dir/<model>.yaml, it never overwrites an existing test
+func SaveScaffold(dir string, model string, content []byte) (string, error) {
+	path := filepath.Join(dir, model+".yaml")
+	if _, err := os.Stat(path); err == nil {
+		return "", fmt.Errorf("%v already exists", path)
+	}
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return "", err
+	}
+	return path, os.WriteFile(path, content, 0644)
+}
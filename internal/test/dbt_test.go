@@ -0,0 +1,56 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/goccy/go-yaml"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolveModels(t *testing.T) {
+	manifest, err := LoadManifest("testdata/dbt/manifest.json")
+	assert.Nil(t, err)
+
+	tests := []Test{{Name: "compiled", Model: "stg_orders"}, {Name: "raw", Model: "revenue"}, {Name: "incremental", Model: "daily_orders"}}
+	assert.Nil(t, ResolveModels(tests, manifest))
+	assert.Equal(t, "select * from `proj`.`raw`.`orders`", tests[0].FileContent)
+
+	assert.Nil(t, RenderTemplates(tests, manifest.TemplateFuncs()))
+	assert.Equal(t, "select c.name, sum(o.amount) as revenue\n"+
+		"from `proj`.`staging`.`stg_orders` o\n"+
+		"join `proj`.`raw`.`customers` c on c.id = o.customer_id\n"+
+		"group by 1", tests[1].FileContent)
+	// The config block is dropped and a test builds the model from scratch, not incrementally
+	assert.Equal(t, "select day, count(*) as orders\n"+
+		"from `proj`.`staging`.`stg_orders`\n"+
+		"group by 1", tests[2].FileContent)
+
+	err = RenderTemplates([]Test{{Name: "macro", Model: "daily_orders", FileContent: "select {{ dbt_utils.star() }}"}}, manifest.TemplateFuncs())
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "run `dbt compile`")
+
+	assert.NotNil(t, ResolveModels([]Test{{Name: "unknown", Model: "missing"}}, manifest))
+}
+
+func TestScaffoldTest(t *testing.T) {
+	manifest, err := LoadManifest("testdata/dbt/manifest.json")
+	assert.Nil(t, err)
+
+	content, err := ScaffoldTest(manifest, "revenue")
+	assert.Nil(t, err)
+	test := Test{}
+	assert.Nil(t, yaml.Unmarshal(content, &test))
+	assert.Equal(t, "revenue", test.Model)
+	assert.Equal(t, 2, len(test.Mocks))
+	assert.Equal(t, "", test.Mocks["`proj`.`staging`.`stg_orders`"].Csv)
+	assert.Equal(t, "id,name\n", test.Mocks["`proj`.`raw`.`customers`"].Csv)
+	assert.Equal(t, map[string]string{"id": "int64", "name": "string"}, test.Mocks["`proj`.`raw`.`customers`"].Schema)
+	assert.Equal(t, "name,revenue\n", test.Output.Csv)
+}
+
+func TestParseModelTest(t *testing.T) {
+	test, err := ParseTest("testdata/dbt/revenue.yaml")
+	assert.Nil(t, err)
+	assert.Equal(t, "revenue", test.Model)
+	assert.Equal(t, "", test.FileContent)
+}
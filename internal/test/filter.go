@@ -0,0 +1,90 @@
+package test
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+)
+
+/*
+Selects the tests to run.
+Run matches test names, a test with Tags needs one of them, a test with one of SkipTags is skipped
+*/
+type Filter struct {
+	Run      *regexp.Regexp
+	Tags     []string
+	SkipTags []string
+}
+
+func NewFilter(run string, tags []string, skipTags []string) (Filter, error) {
+	filter := Filter{Tags: tags, SkipTags: skipTags}
+	if run != "" {
+		re, err := regexp.Compile(run)
+		if err != nil {
+			return Filter{}, fmt.Errorf("invalid --run pattern: %w", err)
+		}
+		filter.Run = re
+	}
+	return filter, nil
+}
+
+func hasAnyTag(t Test, tags []string) bool {
+	for _, tag := range tags {
+		for _, testTag := range t.Tags {
+			if tag == testTag {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (f Filter) Matches(t Test) bool {
+	if f.Run != nil && !f.Run.MatchString(t.Name) {
+		return false
+	}
+	if len(f.Tags) > 0 && !hasAnyTag(t, f.Tags) {
+		return false
+	}
+	return !hasAnyTag(t, f.SkipTags)
+}
+
+// Returns the tests selected by the filter, in order
+func FilterTests(tests []Test, f Filter) []Test {
+	selected := []Test{}
+	for _, t := range tests {
+		if f.Matches(t) {
+			selected = append(selected, t)
+		}
+	}
+	return selected
+}
+
+// Checks that every exclude pattern is a valid glob, filepath.Match only reports bad patterns when matching
+func checkExcludes(excludes []string) error {
+	for _, pattern := range excludes {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid exclude pattern %q: %w", pattern, err)
+		}
+	}
+	return nil
+}
+
+// Returns whether a path under rootPath, or one of its folders under rootPath, matches one of the exclude globs
+func isExcluded(path string, rootPath string, excludes []string) bool {
+	root := filepath.Clean(rootPath)
+	for p := filepath.Clean(path); p != root; p = filepath.Dir(p) {
+		for _, pattern := range excludes {
+			if matched, _ := filepath.Match(filepath.Clean(pattern), p); matched {
+				return true
+			}
+			if matched, _ := filepath.Match(pattern, filepath.Base(p)); matched {
+				return true
+			}
+		}
+		if p == filepath.Dir(p) {
+			break
+		}
+	}
+	return false
+}
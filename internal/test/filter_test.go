@@ -0,0 +1,57 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFilterTests(t *testing.T) {
+	tests := []Test{
+		{Name: "orders/defaults", Tags: []string{"orders", "fast"}},
+		{Name: "orders/refunds", Tags: []string{"orders", "slow"}},
+		{Name: "customers", Tags: []string{"fast"}},
+		{Name: "untagged"},
+	}
+	names := func(f Filter, err error) []string {
+		assert.Nil(t, err)
+		names := []string{}
+		for _, t := range FilterTests(tests, f) {
+			names = append(names, t.Name)
+		}
+		return names
+	}
+	assert.Equal(t, []string{"orders/defaults", "orders/refunds", "customers", "untagged"}, names(NewFilter("", nil, nil)))
+	assert.Equal(t, []string{"orders/defaults", "orders/refunds"}, names(NewFilter("^orders/", nil, nil)))
+	assert.Equal(t, []string{"orders/defaults", "customers"}, names(NewFilter("", []string{"fast"}, nil)))
+	assert.Equal(t, []string{"customers", "untagged"}, names(NewFilter("", nil, []string{"orders"})))
+	assert.Equal(t, []string{"orders/defaults"}, names(NewFilter("orders", []string{"fast"}, []string{"slow"})))
+
+	_, err := NewFilter("(", nil, nil)
+	assert.NotNil(t, err)
+}
+
+func TestParseFolderExclude(t *testing.T) {
+	tests, err := ParseFolder("testdata", "suite")
+	assert.Nil(t, err)
+	for _, test := range tests {
+		assert.NotEqual(t, "testdata/suite/suite.yaml", test.SourceFile)
+	}
+
+	tests, err = ParseFolder("testdata/suite", "testdata/suite/*.yaml")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(tests))
+
+	// The folder being parsed is never excluded itself
+	tests, err = ParseFolder("testdata/suite", "suite")
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(tests))
+
+	_, err = ParseFolder("testdata", "[")
+	assert.NotNil(t, err)
+}
+
+func TestParseSuiteTags(t *testing.T) {
+	test := mergeCase(Test{Name: "s", Tags: []string{"orders"}}, Test{Name: "c", Tags: []string{"slow"}}, caseSettings{})
+	assert.Equal(t, []string{"orders", "slow"}, test.Tags)
+}
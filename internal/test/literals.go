@@ -0,0 +1,132 @@
+package test
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	dateValue      = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}$`)
+	timestampValue = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}[ T]\d{2}:\d{2}:\d{2}(\.\d{1,6})?( ?(Z|UTC|[+-]\d{2}(:?\d{2})?))?$`)
+	// Decimal numbers only, strconv also accepts +5, NaN, Inf and hex floats, which are no BigQuery number literals
+	intValue   = regexp.MustCompile(`^-?\d+$`)
+	floatValue = regexp.MustCompile(`^-?(\d+\.?\d*|\.\d+)([eE][-+]?\d+)?$`)
+)
+
+var literalEscapes = strings.NewReplacer(
+	`\`, `\\`,
+	`"`, `\"`,
+	"\n", `\n`,
+	"\r", `\r`,
+	"\t", `\t`,
+)
+
+// Returns a value as a BigQuery string literal, escaping quotes, backslashes and control characters
+func stringLiteral(value string) string {
+	return `"` + literalEscapes.Replace(value) + `"`
+}
+
+// Returns whether a value is a valid DATE, a regexp alone accepts dates like 2023-02-30
+func isDate(value string) bool {
+	if !dateValue.MatchString(value) {
+		return false
+	}
+	_, err := time.Parse("2006-01-02", value)
+	return err == nil
+}
+
+func isTimestamp(value string) bool {
+	if !timestampValue.MatchString(value) {
+		return false
+	}
+	_, err := time.Parse("2006-01-02", value[:10])
+	return err == nil
+}
+
+// Returns the value standing for NULL in the data of a mock
+func nullValue(m Mock) string {
+	if m.NullMarker != nil {
+		return *m.NullMarker
+	}
+	return ""
+}
+
+/*
+Infers the narrowest BigQuery type that fits every non NULL value of a column.
+Returns an empty string, meaning STRING, when nothing narrower fits or there are no values
+*/
+func inferType(values []string) string {
+	candidates := []struct {
+		name string
+		fits func(string) bool
+	}{
+		{"INT64", func(v string) bool {
+			if !intValue.MatchString(v) {
+				return false
+			}
+			_, err := strconv.ParseInt(v, 10, 64)
+			return err == nil
+		}},
+		{"FLOAT64", func(v string) bool {
+			if !floatValue.MatchString(v) {
+				return false
+			}
+			_, err := strconv.ParseFloat(v, 64)
+			return err == nil
+		}},
+		{"BOOL", func(v string) bool {
+			return strings.EqualFold(v, "true") || strings.EqualFold(v, "false")
+		}},
+		{"DATE", isDate},
+		{"TIMESTAMP", isTimestamp},
+	}
+	for _, candidate := range candidates {
+		fits := len(values) > 0
+		for _, v := range values {
+			if !candidate.fits(v) {
+				fits = false
+				break
+			}
+		}
+		if fits {
+			return candidate.name
+		}
+	}
+	return ""
+}
+
+/*
+Returns the type of every column of a mock, the declared types win over the schema, which wins over inferred ones.
+Types are only inferred when the mock sets infer_types
+*/
+func columnTypes(m Mock, data []map[string]string) map[string]string {
+	types := map[string]string{}
+	for column, columnType := range m.Schema {
+		types[column] = columnType
+	}
+	for column, columnType := range m.Types {
+		types[column] = columnType
+	}
+	if !m.InferTypes {
+		return types
+	}
+	values := map[string][]string{}
+	for _, row := range data {
+		for column, value := range row {
+			if value != nullValue(m) {
+				values[column] = append(values[column], value)
+			}
+		}
+	}
+	for column, columnValues := range values {
+		if _, declared := types[column]; declared {
+			continue
+		}
+		if inferred := inferType(columnValues); inferred != "" {
+			types[column] = inferred
+		}
+	}
+	return types
+}
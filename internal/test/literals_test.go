@@ -0,0 +1,45 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStringLiteral(t *testing.T) {
+	assert.Equal(t, `"plain"`, stringLiteral("plain"))
+	assert.Equal(t, `"say \"hi\""`, stringLiteral(`say "hi"`))
+	assert.Equal(t, `"C:\\temp\\"`, stringLiteral(`C:\temp\`))
+	assert.Equal(t, `"two\nlines"`, stringLiteral("two\nlines"))
+}
+
+func TestInferType(t *testing.T) {
+	assert.Equal(t, "INT64", inferType([]string{"1", "-20"}))
+	assert.Equal(t, "FLOAT64", inferType([]string{"1", "2.5"}))
+	assert.Equal(t, "BOOL", inferType([]string{"true", "FALSE"}))
+	assert.Equal(t, "DATE", inferType([]string{"2023-01-31"}))
+	assert.Equal(t, "TIMESTAMP", inferType([]string{"2023-01-31 10:00:00", "2023-01-31T10:00:00.123Z"}))
+	assert.Equal(t, "", inferType([]string{"2023-02-30"}))
+	assert.Equal(t, "", inferType([]string{"1", "a"}))
+	assert.Equal(t, "", inferType([]string{}))
+	assert.Equal(t, "", inferType([]string{"1", ""}))
+	assert.Equal(t, "", inferType([]string{"NaN"}))
+	assert.Equal(t, "", inferType([]string{"inf", "-Inf"}))
+	assert.Equal(t, "", inferType([]string{"0x1p4"}))
+	assert.Equal(t, "", inferType([]string{"+5"}))
+	assert.Equal(t, "FLOAT64", inferType([]string{".5", "1e3", "2.", "-1.5E-2"}))
+}
+
+func TestColumnTypes(t *testing.T) {
+	data := []map[string]string{{"id": "1", "price": "2.5", "name": "a"}}
+	assert.Equal(t, map[string]string{"price": "NUMERIC"}, columnTypes(Mock{Types: map[string]string{"price": "NUMERIC"}}, data))
+	assert.Equal(t, map[string]string{"id": "INT64", "price": "NUMERIC"},
+		columnTypes(Mock{InferTypes: true, Types: map[string]string{"price": "NUMERIC"}}, data))
+}
+
+func TestColumnTypesNullMarker(t *testing.T) {
+	marker := `\N`
+	data := []map[string]string{{"id": `\N`, "code": ""}, {"id": "2", "code": "7"}}
+	assert.Equal(t, map[string]string{"id": "INT64"}, columnTypes(Mock{InferTypes: true, NullMarker: &marker}, data))
+	assert.Equal(t, map[string]string{}, columnTypes(Mock{InferTypes: true}, []map[string]string{{"id": `\N`}}))
+}
@@ -0,0 +1,125 @@
+package test
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// The location of a table in the emulator
+type tablePath struct {
+	Project string
+	Dataset string
+	Table   string
+}
+
+func (p tablePath) String() string {
+	return fmt.Sprintf("`%s`.`%s`.`%s`", p.Project, p.Dataset, p.Table)
+}
+
+// Splits the name of a materialized mock into its project, dataset and table, the project defaults to the emulator's
+func parseTablePath(tableFullName string, defaultProject string) (tablePath, error) {
+	parts := strings.Split(normalizeTableName(tableFullName), ".")
+	switch len(parts) {
+	case 2:
+		return tablePath{Project: defaultProject, Dataset: parts[0], Table: parts[1]}, nil
+	case 3:
+		return tablePath{Project: parts[0], Dataset: parts[1], Table: parts[2]}, nil
+	}
+	return tablePath{}, fmt.Errorf("materialized mock %v must be named dataset.table or project.dataset.table", tableFullName)
+}
+
+// Returns whether one of the mocks of a test is materialized as an emulator table
+func hasMaterializedMocks(t Test) bool {
+	for _, m := range t.Mocks {
+		if m.Materialize {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the mocks loaded into emulator tables: every mock of a script test, and the materialized mocks of other tests
+func materializedMocks(t Test) map[string]Mock {
+	materialized := map[string]Mock{}
+	for table, m := range t.Mocks {
+		if m.Materialize || isScriptTest(t) {
+			materialized[table] = m
+		}
+	}
+	return materialized
+}
+
+// Returns the mocks replaced by CTEs in the query, every mock but the materialized ones
+func replacedMocks(mocks map[string]Mock) map[string]Mock {
+	replaced := map[string]Mock{}
+	for table, m := range mocks {
+		if !m.Materialize {
+			replaced[table] = m
+		}
+	}
+	return replaced
+}
+
+/*
+Returns the columns of a materialized mock with their type, sorted by name.
+Columns come from its rows and its schema, a column without a declared or inferred type is a STRING
+*/
+func materializedColumns(m Mock) ([]structField, error) {
+	data, err := mockData(m)
+	if err != nil {
+		return nil, err
+	}
+	names := map[string]bool{}
+	for column := range m.Schema {
+		names[column] = true
+	}
+	for _, row := range data {
+		for column := range row {
+			names[column] = true
+		}
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("mock has no columns, declare them with schema")
+	}
+	sorted := []string{}
+	for column := range names {
+		sorted = append(sorted, column)
+	}
+	sort.Strings(sorted)
+
+	types := columnTypes(m, data)
+	columns := []structField{}
+	for _, column := range sorted {
+		declaration := types[column]
+		if declaration == "" {
+			declaration = "STRING"
+		}
+		columnType, err := parseType(declaration)
+		if err != nil {
+			return nil, err
+		}
+		columns = append(columns, structField{Name: column, Type: columnType})
+	}
+	return columns, nil
+}
+
+/*
+Returns the statement loading the rows of a materialized mock into its table, the rows are the same SELECT as a CTE mock.
+Returns an empty statement for a mock without rows
+*/
+func insertMockSql(path tablePath, m Mock) (string, error) {
+	data, err := mockData(m)
+	if err != nil {
+		return "", err
+	}
+	if len(data) == 0 {
+		return "", nil
+	}
+	mockSql, err := mockToSql(m)
+	if err != nil {
+		return "", err
+	}
+	columns := strings.Join(mockSql.Columns, ", ")
+	return fmt.Sprintf("INSERT INTO %s (%s)\nSELECT %s FROM (%s\n)", path, columns, columns, mockSql.Sql), nil
+}
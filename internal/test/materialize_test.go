@@ -0,0 +1,55 @@
+package test
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseTablePath(t *testing.T) {
+	path, err := parseTablePath("`shop`.`orders`", "dummybqproject")
+	assert.Nil(t, err)
+	assert.Equal(t, tablePath{Project: "dummybqproject", Dataset: "shop", Table: "orders"}, path)
+	assert.Equal(t, "`dummybqproject`.`shop`.`orders`", path.String())
+
+	path, err = parseTablePath("proj.shop.orders", "dummybqproject")
+	assert.Nil(t, err)
+	assert.Equal(t, tablePath{Project: "proj", Dataset: "shop", Table: "orders"}, path)
+
+	_, err = parseTablePath("orders", "dummybqproject")
+	assert.NotNil(t, err)
+}
+
+func TestMaterializedColumns(t *testing.T) {
+	columns, err := materializedColumns(Mock{
+		Csv:    "id,tags,name\n1,\"[\"\"a\"\"]\",x\n",
+		Types:  map[string]string{"id": "int64", "tags": "ARRAY<STRING>"},
+		Schema: map[string]string{"day": "date"},
+	})
+	assert.Nil(t, err)
+	declared := []string{}
+	for _, c := range columns {
+		declared = append(declared, c.Name+" "+c.Type.String())
+	}
+	assert.Equal(t, []string{"day date", "id int64", "name STRING", "tags ARRAY<STRING>"}, declared)
+
+	_, err = materializedColumns(Mock{Csv: "\n"})
+	assert.NotNil(t, err)
+}
+
+func TestReplacedMocks(t *testing.T) {
+	mocks := map[string]Mock{"a": {Csv: "x\n1\n"}, "b": {Csv: "x\n1\n", Materialize: true}}
+	assert.Equal(t, []string{"a"}, mockNames(replacedMocks(mocks)))
+	assert.True(t, hasMaterializedMocks(Test{Mocks: mocks}))
+	assert.False(t, hasMaterializedMocks(Test{Mocks: replacedMocks(mocks)}))
+}
+
+func mockNames(mocks map[string]Mock) []string {
+	names := []string{}
+	for name := range mocks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
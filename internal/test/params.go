@@ -0,0 +1,117 @@
+package test
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"cloud.google.com/go/bigquery"
+)
+
+// Types a query parameter may have, on their own or as the elements of an ARRAY
+var paramTypeKinds = map[string]bool{
+	"STRING":    true,
+	"INT64":     true,
+	"FLOAT64":   true,
+	"BOOL":      true,
+	"DATE":      true,
+	"TIMESTAMP": true,
+}
+
+// Checks that a scalar parameter value is valid for its type, so a typo fails before any query runs
+func checkParamValue(value string, typeName string) error {
+	var valid bool
+	switch typeName {
+	case "INT64":
+		_, err := strconv.ParseInt(value, 10, 64)
+		valid = err == nil
+	case "FLOAT64":
+		_, err := strconv.ParseFloat(value, 64)
+		valid = err == nil
+	case "BOOL":
+		valid = strings.EqualFold(value, "true") || strings.EqualFold(value, "false")
+	case "DATE":
+		valid = isDate(value)
+	case "TIMESTAMP":
+		valid = isTimestamp(value)
+	default:
+		valid = true
+	}
+	if !valid {
+		return fmt.Errorf("invalid %s value %q", typeName, value)
+	}
+	return nil
+}
+
+func scalarParamType(t *sqlType) (bigquery.StandardSQLDataType, error) {
+	kind := strings.ToUpper(t.Name)
+	if !paramTypeKinds[kind] || t.Elem != nil || t.Fields != nil {
+		return bigquery.StandardSQLDataType{}, fmt.Errorf("unsupported parameter type %s", t)
+	}
+	return bigquery.StandardSQLDataType{TypeKind: kind}, nil
+}
+
+/*
+Converts a parameter into a typed query parameter value.
+Values are sent as text along with their type, so an empty ARRAY keeps its element type
+*/
+func paramValue(p Param) (*bigquery.QueryParameterValue, error) {
+	t, err := parseType(p.Type)
+	if err != nil {
+		return nil, err
+	}
+	if t.Elem == nil {
+		paramType, err := scalarParamType(t)
+		if err != nil {
+			return nil, err
+		}
+		value := formatValue(p.Value)
+		if err := checkParamValue(value, paramType.TypeKind); err != nil {
+			return nil, err
+		}
+		return &bigquery.QueryParameterValue{Type: paramType, Value: value}, nil
+	}
+
+	elemType, err := scalarParamType(t.Elem)
+	if err != nil {
+		return nil, err
+	}
+	items, ok := p.Value.([]interface{})
+	if p.Value != nil && !ok {
+		return nil, fmt.Errorf("expected a list for %s, got %v", t, p.Value)
+	}
+	values := []bigquery.QueryParameterValue{}
+	for _, item := range items {
+		value := formatValue(item)
+		if err := checkParamValue(value, elemType.TypeKind); err != nil {
+			return nil, err
+		}
+		values = append(values, bigquery.QueryParameterValue{Type: elemType, Value: value})
+	}
+	// The client ignores an empty ArrayValue and reads Value instead, which must then be an empty slice
+	return &bigquery.QueryParameterValue{
+		Type:       bigquery.StandardSQLDataType{TypeKind: "ARRAY", ArrayElementType: &elemType},
+		ArrayValue: values,
+		Value:      []string{},
+	}, nil
+}
+
+// Returns the named query parameters of a test, sorted by name
+func queryParameters(params map[string]Param) ([]bigquery.QueryParameter, error) {
+	names := []string{}
+	for name := range params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	parameters := []bigquery.QueryParameter{}
+	for _, name := range names {
+		value, err := paramValue(params[name])
+		if err != nil {
+			return nil, fmt.Errorf("parameter %s: %w", name, err)
+		}
+		parameters = append(parameters, bigquery.QueryParameter{Name: name, Value: value})
+	}
+	return parameters, nil
+}
@@ -0,0 +1,45 @@
+package test
+
+import (
+	"testing"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQueryParameters(t *testing.T) {
+	params, err := queryParameters(map[string]Param{
+		"run_date":  {Type: "DATE", Value: "2024-01-31"},
+		"min_count": {Type: "int64", Value: uint64(3)},
+		"ids":       {Type: "ARRAY<INT64>", Value: []interface{}{uint64(1), uint64(2)}},
+		"no_tags":   {Type: "ARRAY<STRING>", Value: []interface{}{}},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"ids", "min_count", "no_tags", "run_date"},
+		[]string{params[0].Name, params[1].Name, params[2].Name, params[3].Name})
+
+	int64Type := bigquery.StandardSQLDataType{TypeKind: "INT64"}
+	assert.Equal(t, &bigquery.QueryParameterValue{
+		Type:       bigquery.StandardSQLDataType{TypeKind: "ARRAY", ArrayElementType: &int64Type},
+		ArrayValue: []bigquery.QueryParameterValue{{Type: int64Type, Value: "1"}, {Type: int64Type, Value: "2"}},
+		Value:      []string{},
+	}, params[0].Value)
+	assert.Equal(t, &bigquery.QueryParameterValue{Type: int64Type, Value: "3"}, params[1].Value)
+	assert.Equal(t, &bigquery.QueryParameterValue{
+		Type: bigquery.StandardSQLDataType{TypeKind: "DATE"}, Value: "2024-01-31",
+	}, params[3].Value)
+}
+
+func TestQueryParametersInvalid(t *testing.T) {
+	for _, param := range []Param{
+		{Type: "DATE", Value: "2024-02-30"},
+		{Type: "INT64", Value: "ten"},
+		{Type: "TIMESTAMP", Value: "yesterday"},
+		{Type: "ARRAY<DATE>", Value: "2024-01-31"},
+		{Type: "ARRAY<ARRAY<INT64>>", Value: []interface{}{}},
+		{Type: "STRUCT<id INT64>", Value: map[string]interface{}{"id": 1}},
+	} {
+		_, err := queryParameters(map[string]Param{"p": param})
+		assert.NotNil(t, err, param.Type)
+	}
+}
@@ -2,11 +2,14 @@ package test
 
 import (
 	"encoding/csv"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"log"
 	"os"
 	"path/filepath"
+	"reflect"
+	"strconv"
 	"strings"
 
 	"github.com/goccy/go-yaml"
@@ -14,47 +17,212 @@ import (
 
 // Returns a Test structure given a filepath
 func ParseTest(path string) (Test, error) {
+	tests, err := ParseTests(path)
+	if err != nil {
+		return Test{}, err
+	}
+	if len(tests) != 1 {
+		return Test{}, fmt.Errorf("%v defines a suite of %d cases, use ParseTests instead", path, len(tests))
+	}
+	return tests[0], nil
+}
+
+/*
+Returns the Tests defined in a yaml file.
+A plain test definition yields a single Test, a suite yields one Test per case named `suite/case`
+*/
+func ParseTests(path string) ([]Test, error) {
 
 	yamlFile, err := os.Open(path)
 	if err != nil {
-		return Test{}, err
+		return nil, err
 	}
+	defer yamlFile.Close()
 	bytes, err := io.ReadAll(yamlFile)
 	if err != nil {
-		return Test{}, err
+		return nil, err
 	}
-	test := Test{}
-	if err := yaml.Unmarshal(bytes, &test); err != nil {
-		return Test{}, err
+	suite := Suite{}
+	if err := yaml.Unmarshal(bytes, &suite); err != nil {
+		return nil, err
 	}
-	sqlQuery, err := ReadContents(test.File)
-	test.FileContent = sqlQuery
-	test.SourceFile = path
-	if err != nil {
-		return Test{}, err
+	if len(suite.Cases) == 0 {
+		test := suite.Test
+		test.SourceFile = path
+		// The SQL of a dbt model comes from the manifest, see ResolveModels
+		if test.Model != "" && test.File == "" {
+			return []Test{test}, nil
+		}
+		sqlQuery, err := ReadContents(test.File)
+		test.FileContent = sqlQuery
+		if err != nil {
+			return nil, err
+		}
+		return []Test{test}, nil
+	}
+	// A Test cannot tell a case setting ignore_duplicates: false from one leaving it out
+	settings := struct {
+		Cases []caseSettings `yaml:"cases"`
+	}{}
+	if err := yaml.Unmarshal(bytes, &settings); err != nil {
+		return nil, err
 	}
-	return test, nil
+	return expandSuite(path, suite, settings.Cases)
 }
 
-// Returns Test structs found in a given folder
-func ParseFolder(rootPath string) ([]Test, error) {
+// Expands every case of a suite into a Test, cases inherit the suite's file, mocks and output
+func expandSuite(path string, suite Suite, settings []caseSettings) ([]Test, error) {
+	if suite.Name == "" {
+		suite.Name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+	suiteSql := ""
+	if suite.File != "" {
+		sqlQuery, err := ReadContents(suite.File)
+		if err != nil {
+			return nil, err
+		}
+		suiteSql = sqlQuery
+	}
+
 	tests := []Test{}
+	for i, c := range suite.Cases {
+		if c.Name == "" {
+			c.Name = fmt.Sprintf("case_%d", i+1)
+		}
+		test := mergeCase(suite.Test, c, settings[i])
+		test.SourceFile = path
+		if test.File == "" && test.Model == "" {
+			return nil, fmt.Errorf("case %v does not declare a file or a model and neither does its suite", test.Name)
+		}
+		switch {
+		case test.File == "":
+			// A dbt model, its SQL comes from the manifest
+		case c.File == "":
+			test.FileContent = suiteSql
+		default:
+			sqlQuery, err := ReadContents(c.File)
+			if err != nil {
+				return nil, err
+			}
+			test.FileContent = sqlQuery
+		}
+		tests = append(tests, test)
+	}
+	return tests, nil
+}
+
+// Applies the overrides of a case on top of the suite defaults, settings are the ones the case declares
+func mergeCase(suite Test, c Test, settings caseSettings) Test {
+	test := suite
+	test.Name = fmt.Sprintf("%s/%s", suite.Name, c.Name)
+	if c.File != "" {
+		test.File = c.File
+		test.Model = ""
+	}
+	if c.Model != "" {
+		test.Model = c.Model
+		test.File = ""
+	}
+	test.Mocks = map[string]Mock{}
+	for table, mock := range suite.Mocks {
+		test.Mocks[table] = mock
+	}
+	// A case drops a mock of the suite by setting it to null, e.g. when its own file does not read the table
+	for table, mock := range c.Mocks {
+		if reflect.ValueOf(mock).IsZero() {
+			delete(test.Mocks, table)
+			continue
+		}
+		test.Mocks[table] = mock
+	}
+	if !reflect.ValueOf(c.Output).IsZero() {
+		test.Output = c.Output
+	}
+	// A case checking targets replaces those of the suite, they are the expectation like its output
+	targets := suite.Targets
+	if len(c.Targets) > 0 {
+		targets = c.Targets
+	}
+	test.Targets = map[string]Mock{}
+	for table, target := range targets {
+		test.Targets[table] = target
+	}
+	if settings.IgnoreDuplicates != nil {
+		test.IgnoreDuplicates = *settings.IgnoreDuplicates
+	}
+	if settings.ExpectError != nil {
+		test.ExpectError = *settings.ExpectError
+	}
+	test.Params = map[string]Param{}
+	for name, param := range suite.Params {
+		test.Params[name] = param
+	}
+	for name, param := range c.Params {
+		test.Params[name] = param
+	}
+	test.Tags = append(append([]string{}, suite.Tags...), c.Tags...)
+	test.Vars = map[string]interface{}{}
+	for name, value := range suite.Vars {
+		test.Vars[name] = value
+	}
+	for name, value := range c.Vars {
+		test.Vars[name] = value
+	}
+	return test
+}
+
+// Sets the null marker of every mock, output and target that does not declare its own
+func SetNullMarker(tests []Test, marker string) {
+	for i := range tests {
+		for table, mock := range tests[i].Mocks {
+			if mock.NullMarker == nil {
+				mock.NullMarker = &marker
+				tests[i].Mocks[table] = mock
+			}
+		}
+		for table, target := range tests[i].Targets {
+			if target.NullMarker == nil {
+				target.NullMarker = &marker
+				tests[i].Targets[table] = target
+			}
+		}
+		if tests[i].Output.NullMarker == nil {
+			tests[i].Output.NullMarker = &marker
+		}
+	}
+}
+
+/*
+Returns Test structs found in a given folder.
+Definitions whose path, or one of its folders, matches one of the exclude globs are not parsed
+*/
+func ParseFolder(rootPath string, excludes ...string) ([]Test, error) {
+	tests := []Test{}
+	if err := checkExcludes(excludes); err != nil {
+		return nil, err
+	}
 
 	// Walk through all files and directories recursively
 	err := filepath.WalkDir(rootPath, func(path string, d os.DirEntry, err error) error {
 		if err != nil {
 			return err
 		}
+		if isExcluded(path, rootPath, excludes) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
 
 		// Check if the file has a .yaml extension
-		if !d.IsDir() && strings.HasSuffix(strings.ToLower(d.Name()), ".yaml") {
-			fmt.Println(fmt.Sprintf("Detected test: %v", path))
+		if !d.IsDir() && strings.HasSuffix(strings.ToLower(d.Name()), ".yaml") && d.Name() != ConfigFileName {
+			fmt.Fprintf(os.Stderr, "Detected test: %v\n", path)
 
-			test, err := ParseTest(path)
+			parsed, err := ParseTests(path)
 			if err != nil {
 				return fmt.Errorf("failed to parse test %v: %w", path, err)
 			}
-			tests = append(tests, test)
+			tests = append(tests, parsed...)
 		}
 
 		return nil
@@ -70,8 +238,9 @@ func ParseFolder(rootPath string) ([]Test, error) {
 /*
 Utility Function, converts a CSV file into a List of dictionaries.
 Each row is converted into a dictionary where the keys are columns.
+Returns an error for a malformed CSV, such as a row with more or less fields than the header
 */
-func CSVToMap(reader io.Reader) []map[string]string {
+func CSVToMap(reader io.Reader) ([]map[string]string, error) {
 
 	r := csv.NewReader(reader)
 	rows := []map[string]string{}
@@ -82,7 +251,7 @@ func CSVToMap(reader io.Reader) []map[string]string {
 			break
 		}
 		if err != nil {
-			log.Fatal(err)
+			return nil, fmt.Errorf("invalid CSV: %w", err)
 		}
 		if header == nil {
 			header = record
@@ -94,7 +263,87 @@ func CSVToMap(reader io.Reader) []map[string]string {
 			rows = append(rows, dict)
 		}
 	}
-	return rows
+	return rows, nil
+}
+
+/*
+Returns the rows of a mock as a List of dictionaries.
+Data can come from a CSV file, an inline csv block or inline rows declared in the yaml
+*/
+func mockData(m Mock) ([]map[string]string, error) {
+	sources := 0
+	for _, declared := range []bool{m.Filepath != "", m.Csv != "", m.Rows != nil} {
+		if declared {
+			sources++
+		}
+	}
+	if sources == 0 {
+		return nil, errors.New("mock declares no data, set one of filepath, csv or rows")
+	}
+	if sources > 1 {
+		return nil, errors.New("mock declares more than one of filepath, csv or rows")
+	}
+
+	switch {
+	case m.Csv != "":
+		return CSVToMap(strings.NewReader(m.Csv))
+	case m.Rows != nil:
+		return rowsToMap(m.Rows, nullValue(m)), nil
+	}
+	file, err := os.Open(m.Filepath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	data, err := CSVToMap(file)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %w", m.Filepath, err)
+	}
+	return data, nil
+}
+
+// Converts inline yaml rows into string dictionaries, nulls and columns missing in a row are set to nullValue
+func rowsToMap(rows []map[string]interface{}, nullValue string) []map[string]string {
+	columns := map[string]bool{}
+	for _, row := range rows {
+		for column := range row {
+			columns[column] = true
+		}
+	}
+	data := []map[string]string{}
+	for _, row := range rows {
+		dict := map[string]string{}
+		for column := range columns {
+			if row[column] == nil {
+				dict[column] = nullValue
+			} else {
+				dict[column] = formatValue(row[column])
+			}
+		}
+		data = append(data, dict)
+	}
+	return data
+}
+
+// Formats a yaml scalar the way it would have been written in a CSV cell
+func formatValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case map[string]interface{}, []interface{}:
+		// Nested values are written as JSON, like in a CSV cell
+		content, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Sprintf("%v", v)
+		}
+		return string(content)
+	default:
+		return fmt.Sprintf("%v", v)
+	}
 }
 
 func SaveSQL(path string, sql string) error {
@@ -0,0 +1,106 @@
+package test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSuite(t *testing.T) {
+	tests, err := ParseFolder("testdata/suite")
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(tests))
+
+	defaults := tests[0]
+	assert.Equal(t, "users/defaults", defaults.Name)
+	assert.Equal(t, "testdata/suite/suite.yaml", defaults.SourceFile)
+	assert.Equal(t, "select id, name from `dataset`.`users` join `dataset`.`groups` using (id)", defaults.FileContent)
+	assert.Equal(t, "testdata/suite/groups.csv", defaults.Mocks["`dataset`.`groups`"].Filepath)
+	assert.Equal(t, "testdata/suite/out.csv", defaults.Output.Filepath)
+
+	noGroups := tests[1]
+	assert.Equal(t, "users/no-groups", noGroups.Name)
+	assert.Equal(t, "testdata/suite/users.csv", noGroups.Mocks["`dataset`.`users`"].Filepath)
+	assert.Equal(t, "testdata/suite/groups_empty.csv", noGroups.Mocks["`dataset`.`groups`"].Filepath)
+	assert.Equal(t, "testdata/suite/out_empty.csv", noGroups.Output.Filepath)
+
+	otherFile := tests[2]
+	assert.Equal(t, "users/case_3", otherFile.Name)
+	assert.Equal(t, "select id from `dataset`.`users`", otherFile.FileContent)
+	assert.Equal(t, []string{"`dataset`.`users`"}, mockNames(otherFile.Mocks))
+}
+
+func TestParseSuiteCaseSettings(t *testing.T) {
+	dir := t.TempDir()
+	suite := `name: orders
+file: testdata/suite/query.sql
+ignore_duplicates: true
+expect_error: division by zero
+cases:
+  - name: inherits
+  - name: clears
+    ignore_duplicates: false
+    expect_error: ""
+`
+	path := filepath.Join(dir, "suite.yaml")
+	assert.Nil(t, os.WriteFile(path, []byte(suite), 0644))
+	tests, err := ParseTests(path)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(tests))
+	assert.True(t, tests[0].IgnoreDuplicates)
+	assert.Equal(t, "division by zero", tests[0].ExpectError)
+	assert.False(t, tests[1].IgnoreDuplicates)
+	assert.Equal(t, "", tests[1].ExpectError)
+}
+
+func TestParseTestRejectsSuite(t *testing.T) {
+	_, err := ParseTest("testdata/suite/suite.yaml")
+	assert.NotNil(t, err)
+}
+
+func TestMockDataInline(t *testing.T) {
+	rows, err := mockData(Mock{Rows: []map[string]interface{}{
+		{"id": uint64(1), "name": "a", "score": 2.5},
+		{"id": uint64(2), "active": true},
+	}})
+	assert.Nil(t, err)
+	assert.Equal(t, []map[string]string{
+		{"id": "1", "name": "a", "score": "2.5", "active": ""},
+		{"id": "2", "name": "", "score": "", "active": "true"},
+	}, rows)
+
+	rows, err = mockData(Mock{Csv: "id,name\n1,a\n2,b\n"})
+	assert.Nil(t, err)
+	assert.Equal(t, []map[string]string{{"id": "1", "name": "a"}, {"id": "2", "name": "b"}}, rows)
+
+	_, err = mockData(Mock{Csv: "id\n1\n", Filepath: "in.csv"})
+	assert.NotNil(t, err)
+}
+
+func TestMockDataMalformedCsv(t *testing.T) {
+	_, err := mockData(Mock{Csv: "id,name\n1,a,extra\n"})
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "invalid CSV")
+}
+
+func TestMockDataInlineNested(t *testing.T) {
+	rows, err := mockData(Mock{Rows: []map[string]interface{}{
+		{"id": uint64(1), "items": []interface{}{map[string]interface{}{"id": uint64(2), "tags": []interface{}{"a"}}}},
+	}})
+	assert.Nil(t, err)
+	assert.Equal(t, []map[string]string{{"id": "1", "items": `[{"id":2,"tags":["a"]}]`}}, rows)
+}
+
+func TestMockDataNullMarker(t *testing.T) {
+	tests := []Test{{Mocks: map[string]Mock{"a": {Csv: "x\n\\N\n"}}}}
+	SetNullMarker(tests, `\N`)
+	assert.Equal(t, `\N`, *tests[0].Mocks["a"].NullMarker)
+	assert.Equal(t, `\N`, *tests[0].Output.NullMarker)
+
+	marker := "NULL"
+	rows, err := mockData(Mock{NullMarker: &marker, Rows: []map[string]interface{}{{"x": ""}, {"y": "b"}}})
+	assert.Nil(t, err)
+	assert.Equal(t, []map[string]string{{"x": "", "y": "NULL"}, {"x": "NULL", "y": "b"}}, rows)
+}
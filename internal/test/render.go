@@ -0,0 +1,160 @@
+package test
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/alexeyco/simpletable"
+)
+
+const (
+	extraRowsMessage   = "Query output has records not in expectation"
+	missingRowsMessage = "Query output is missing expected records"
+)
+
+func tableExtraRowsMessage(table string) string {
+	return fmt.Sprintf("Table %s has records not in expectation", table)
+}
+
+func tableMissingRowsMessage(table string) string {
+	return fmt.Sprintf("Table %s is missing expected records", table)
+}
+
+func orderDiffMessage(diff OrderDiff) string {
+	return fmt.Sprintf("Query output differs from the ordered expectation at row %d", diff.Position)
+}
+
+// Renders a set of records as a table, with the footer spanning all the columns
+func rowsTable(rows RowSet, footer string) string {
+	table := simpletable.New()
+	table.Header = &simpletable.Header{}
+	for _, column := range rows.Columns {
+		table.Header.Cells = append(table.Header.Cells, &simpletable.Cell{
+			Align: simpletable.AlignCenter, Text: column,
+		})
+	}
+	var cells [][]*simpletable.Cell
+	for _, row := range rows.Rows {
+		var rowCells []*simpletable.Cell
+		for _, value := range row {
+			rowCells = append(rowCells, &simpletable.Cell{Text: value})
+		}
+		cells = append(cells, rowCells)
+	}
+	table.Body = &simpletable.Body{Cells: cells}
+	table.Footer = &simpletable.Footer{
+		Cells: []*simpletable.Cell{
+			{Align: simpletable.AlignCenter, Span: len(rows.Columns), Text: footer},
+		},
+	}
+	table.SetStyle(simpletable.StyleDefault)
+	return table.String()
+}
+
+// Renders the expected and actual rows of an ordered output side by side, marking the first row that differs
+func orderDiffTable(diff OrderDiff, marker string) string {
+	table := simpletable.New()
+	table.Header = &simpletable.Header{Cells: []*simpletable.Cell{
+		{Align: simpletable.AlignCenter, Text: "#"},
+		{Align: simpletable.AlignCenter, Text: fmt.Sprintf("Expected (%s)", strings.Join(diff.Columns, ", "))},
+		{Align: simpletable.AlignCenter, Text: "Actual"},
+		{Align: simpletable.AlignCenter, Text: ""},
+	}}
+	var cells [][]*simpletable.Cell
+	for i := 0; i < len(diff.Expected) || i < len(diff.Actual); i++ {
+		expected, actual := "", ""
+		if i < len(diff.Expected) {
+			expected = strings.Join(diff.Expected[i], ", ")
+		}
+		if i < len(diff.Actual) {
+			actual = strings.Join(diff.Actual[i], ", ")
+		}
+		mark := ""
+		if i+1 == diff.Position {
+			mark = marker
+		}
+		cells = append(cells, []*simpletable.Cell{
+			{Align: simpletable.AlignRight, Text: fmt.Sprintf("%d", i+1)},
+			{Text: expected},
+			{Text: actual},
+			{Text: mark},
+		})
+	}
+	table.Body = &simpletable.Body{Cells: cells}
+	table.SetStyle(simpletable.StyleDefault)
+	return table.String()
+}
+
+// Prints the results as colored text, with the differing records of failed tests and a summary
+func RenderText(w io.Writer, results []TestResult) {
+	failures := 0
+	for _, r := range results {
+		fmt.Fprintln(w, "")
+		fmt.Fprintln(w, fmt.Sprintf("Running Test: %+v : %+v", r.Name, r.SourceFile))
+		if r.Error != "" {
+			fmt.Fprintln(w, red(fmt.Sprintf("ERROR - %s\n", r.Error)))
+		}
+		if len(r.ExtraRows.Rows) > 0 {
+			fmt.Fprintln(w, rowsTable(r.ExtraRows, yellow("Additional Records")))
+			fmt.Fprintln(w, red(fmt.Sprintf("ERROR - %s\n", extraRowsMessage)))
+		}
+		if len(r.MissingRows.Rows) > 0 {
+			fmt.Fprintln(w, rowsTable(r.MissingRows, yellow("Missing Records")))
+			fmt.Fprintln(w, red(fmt.Sprintf("ERROR - %s\n", missingRowsMessage)))
+		}
+		if r.OrderDiff != nil {
+			fmt.Fprintln(w, orderDiffTable(*r.OrderDiff, yellow("<<")))
+			fmt.Fprintln(w, red(fmt.Sprintf("ERROR - %s\n", orderDiffMessage(*r.OrderDiff))))
+		}
+		for _, diff := range r.TableDiffs {
+			if len(diff.ExtraRows.Rows) > 0 {
+				fmt.Fprintln(w, rowsTable(diff.ExtraRows, yellow(fmt.Sprintf("Additional Records in %s", diff.Table))))
+				fmt.Fprintln(w, red(fmt.Sprintf("ERROR - %s\n", tableExtraRowsMessage(diff.Table))))
+			}
+			if len(diff.MissingRows.Rows) > 0 {
+				fmt.Fprintln(w, rowsTable(diff.MissingRows, yellow(fmt.Sprintf("Missing Records in %s", diff.Table))))
+				fmt.Fprintln(w, red(fmt.Sprintf("ERROR - %s\n", tableMissingRowsMessage(diff.Table))))
+			}
+		}
+
+		if r.Status == StatusPassed {
+			fmt.Fprintln(w, green(fmt.Sprintf("Test Success: %+v : %+v\n", r.Name, r.SourceFile)))
+		} else {
+			fmt.Fprintln(w, red(fmt.Sprintf("Test Failed: %+v : %+v\n", r.Name, r.SourceFile)))
+			failures++
+		}
+	}
+
+	// Test Summary
+	fmt.Fprintf(w, "\nTest Summary: %d tests run, %d passed, %d failed\n",
+		len(results), len(results)-failures, failures)
+}
+
+// Prints the results as an indented JSON array, durations are in seconds
+func RenderJSON(w io.Writer, results []TestResult) error {
+	type jsonResult struct {
+		TestResult
+		Duration float64 `json:"duration"`
+	}
+	out := []jsonResult{}
+	for _, r := range results {
+		out = append(out, jsonResult{TestResult: r, Duration: r.Duration.Seconds()})
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(out)
+}
+
+// Prints the results in the given format, either "text" or "json"
+func Render(format string, w io.Writer, results []TestResult) error {
+	switch format {
+	case "text":
+		RenderText(w, results)
+		return nil
+	case "json":
+		return RenderJSON(w, results)
+	}
+	return fmt.Errorf("unsupported output format %q, expected text or json", format)
+}
@@ -0,0 +1,85 @@
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRenderJSON(t *testing.T) {
+	results := []TestResult{{
+		Name:        "failing",
+		SourceFile:  "tests/b.yaml",
+		Status:      StatusFailed,
+		Duration:    250 * time.Millisecond,
+		SQL:         SQLTestQuery{QueryWithMockedData: "select 1"},
+		ExtraRows:   RowSet{Columns: []string{"id"}, Rows: [][]string{{"1"}}},
+		MissingRows: RowSet{Columns: []string{}, Rows: [][]string{}},
+	}}
+	out := bytes.Buffer{}
+	assert.Nil(t, Render("json", &out, results))
+
+	decoded := []map[string]interface{}{}
+	assert.Nil(t, json.Unmarshal(out.Bytes(), &decoded))
+	assert.Equal(t, 1, len(decoded))
+	assert.Equal(t, "failing", decoded[0]["name"])
+	assert.Equal(t, "tests/b.yaml", decoded[0]["source_file"])
+	assert.Equal(t, "failed", decoded[0]["status"])
+	assert.Equal(t, 0.25, decoded[0]["duration"])
+	assert.Equal(t, "select 1", decoded[0]["sql"].(map[string]interface{})["query_with_mocked_data"])
+	assert.Equal(t, []interface{}{[]interface{}{"1"}}, decoded[0]["extra_rows"].(map[string]interface{})["rows"])
+	assert.NotContains(t, decoded[0], "error")
+}
+
+func TestRenderText(t *testing.T) {
+	results := []TestResult{
+		{Name: "passing", SourceFile: "tests/a.yaml", Status: StatusPassed},
+		{Name: "broken", SourceFile: "tests/c.yaml", Status: StatusError, Error: "invalid test definition tests/c.yaml"},
+	}
+	out := bytes.Buffer{}
+	assert.Nil(t, Render("text", &out, results))
+	assert.Contains(t, out.String(), "Test Success: passing : tests/a.yaml")
+	assert.Contains(t, out.String(), "ERROR - invalid test definition tests/c.yaml")
+	assert.Contains(t, out.String(), "Test Summary: 2 tests run, 1 passed, 1 failed")
+
+	assert.NotNil(t, Render("yaml", &out, results))
+}
+
+func TestRenderTextOrderDiff(t *testing.T) {
+	results := []TestResult{{
+		Name:   "ordered",
+		Status: StatusFailed,
+		OrderDiff: &OrderDiff{
+			Position: 2,
+			Columns:  []string{"id"},
+			Expected: [][]string{{"1"}, {"2"}},
+			Actual:   [][]string{{"1"}, {"3"}},
+		},
+	}}
+	out := bytes.Buffer{}
+	RenderText(&out, results)
+	assert.Contains(t, out.String(), "Expected (id)")
+	assert.Contains(t, out.String(), "differs from the ordered expectation at row 2")
+	assert.Equal(t, 1, strings.Count(out.String(), "<<"))
+}
+
+func TestRenderTextTableDiffs(t *testing.T) {
+	results := []TestResult{{
+		Name:   "merge-customers",
+		Status: StatusFailed,
+		TableDiffs: []TableDiff{{
+			Table:       "`crm`.`customers`",
+			ExtraRows:   RowSet{Columns: []string{"id"}, Rows: [][]string{{"3"}}},
+			MissingRows: RowSet{Columns: []string{"id"}, Rows: [][]string{}},
+		}},
+	}}
+	out := bytes.Buffer{}
+	RenderText(&out, results)
+	assert.Contains(t, out.String(), "Additional Records in `crm`.`customers`")
+	assert.Contains(t, out.String(), "ERROR - Table `crm`.`customers` has records not in expectation")
+	assert.NotContains(t, out.String(), "Missing Records")
+}
@@ -1,34 +1,373 @@
 package test
 
 import (
+	"errors"
 	"fmt"
 	"os"
-	"regexp"
+	"sort"
 	"strings"
+
+	"github.com/goccy/go-zetasql"
+	"github.com/goccy/go-zetasql/ast"
 )
 
 /*
 Given a SQL query and a replacement Struct, it applies the replacement on the SQL and returns a new SQL query
 References to a Table are replaced
 */
-func Replace(sql string, replacement Replacement) string {
-	/*
-	 This has a little quirk, BQ allows for the query aliases to be defined without the "as" keyword
-	 However this replacement logic does not seem to account for that yet
-	*/
-
+func Replace(sql string, replacement Replacement) (string, error) {
 	if (replacement == Replacement{}) {
-		return sql
+		return sql, nil
+	}
+	return ReplaceAll(sql, []Replacement{replacement})
+}
+
+/*
+Applies all the replacements on the SQL in a single pass.
+The query is parsed with ZetaSQL and every table path found in the parse tree is rewritten exactly once,
+whether it is quoted or not, has an alias or not, or sits in a subquery, a join or a DML statement.
+Table names inside string literals and comments are left untouched,
+so are references to CTEs and paths rooted on a table alias, which are resolved like the tables a query reads from.
+*/
+func ReplaceAll(sql string, replacements []Replacement) (string, error) {
+	byName := map[string]Replacement{}
+	for _, r := range replacements {
+		byName[normalizeTableName(r.TableFullName)] = r
+	}
+	script, err := parseScript(sql)
+	if err != nil {
+		return "", err
+	}
+	references, err := tableReferences(script)
+	if err != nil {
+		return "", err
+	}
+	// Splicing from the end of the query keeps the offsets of earlier references valid
+	sort.Slice(references, func(i, j int) bool {
+		return references[i].Start > references[j].Start
+	})
+	for _, ref := range references {
+		r, ok := byName[ref.Name]
+		if !ok {
+			continue
+		}
+		newTable := fmt.Sprintf("(%s)", r.ReplaceSql)
+		if !ref.HasAlias {
+			newTable = fmt.Sprintf("%s AS %s", newTable, r.TableShortName)
+		}
+		sql = sql[:ref.Start] + newTable + sql[ref.End:]
+	}
+	return sql, nil
+}
+
+func parseScript(sql string) (ast.ScriptNode, error) {
+	script, err := zetasql.ParseScript(sql, parserOptions(), zetasql.ErrorMessageOneLine)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse query: %w", err)
 	}
-	regexWithAlias, err := regexp.Compile(fmt.Sprintf(`(?i)%s\sas\s([A-z0-9_]+)\s`, replacement.TableFullName))
+	return script, nil
+}
+
+// Returns every table path referenced in the FROM clauses of a query or script, CTEs and alias-rooted paths excluded
+func tableReferences(script ast.ScriptNode) ([]TableReference, error) {
+	references := []TableReference{}
+	err := ast.Walk(script, func(n ast.Node) error {
+		table, ok := n.(*ast.TablePathExpressionNode)
+		if !ok || table.PathExpr() == nil || isLocalReference(table) {
+			return nil
+		}
+		path := table.PathExpr()
+		location := path.ParseLocationRange()
+		references = append(references, TableReference{
+			Name:     pathName(path),
+			Start:    location.Start().ByteOffset(),
+			End:      location.End().ByteOffset(),
+			HasAlias: table.Alias() != nil,
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return references, nil
+}
+
+// Returns the unquoted dotted name of a path
+func pathName(path *ast.PathExpressionNode) string {
+	names := []string{}
+	for _, identifier := range path.Names() {
+		names = append(names, identifier.Name())
+	}
+	return normalizeTableName(strings.Join(names, "."))
+}
+
+/*
+Returns the tables a script writes to, without duplicates and sorted:
+the targets of its INSERT, UPDATE, DELETE and MERGE statements, and the tables it creates
+*/
+func writtenTables(script ast.ScriptNode) ([]string, error) {
+	seen := map[string]bool{}
+	tables := []string{}
+	add := func(path ast.Node) {
+		if p, ok := path.(*ast.PathExpressionNode); ok && p != nil && !seen[pathName(p)] {
+			seen[pathName(p)] = true
+			tables = append(tables, pathName(p))
+		}
+	}
+	err := ast.Walk(script, func(n ast.Node) error {
+		switch node := n.(type) {
+		case *ast.InsertStatementNode:
+			add(node.TargetPath())
+		case *ast.UpdateStatementNode:
+			add(node.TargetPath())
+		case *ast.DeleteStatementNode:
+			add(node.TargetPath())
+		case *ast.MergeStatementNode:
+			add(node.TargetPath())
+		case *ast.CreateTableStatementNode:
+			add(node.Name())
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(tables)
+	return tables, nil
+}
+
+/*
+Returns the names a FROM clause binds: the explicit or implicit alias of each of its items.
+The table path starting at skip is left out, the names of subqueries inside the clause are not visible outside of them
+*/
+func fromClauseAliases(from *ast.FromClauseNode, skip int) map[string]bool {
+	aliases := map[string]bool{}
+	var visit func(n ast.Node)
+	visit = func(n ast.Node) {
+		switch node := n.(type) {
+		case nil, *ast.QueryNode:
+			return
+		case *ast.TablePathExpressionNode:
+			isSkipped := node.PathExpr() != nil && node.PathExpr().ParseLocationRange().Start().ByteOffset() == skip
+			switch {
+			case isSkipped:
+			case node.Alias() != nil:
+				aliases[strings.ToLower(node.Alias().Name())] = true
+			case node.PathExpr() != nil:
+				// A table path without an alias is named after its last segment
+				parts := strings.Split(pathName(node.PathExpr()), ".")
+				aliases[strings.ToLower(parts[len(parts)-1])] = true
+			}
+		case *ast.TableSubqueryNode:
+			if node.Alias() != nil {
+				aliases[strings.ToLower(node.Alias().Name())] = true
+			}
+			return
+		}
+		for i := 0; i < n.NumChildren(); i++ {
+			visit(n.Child(i))
+		}
+	}
+	visit(from)
+	return aliases
+}
+
+// Returns the tables a script creates, they hold no rows before it runs and need no mock
+func createdTables(script ast.ScriptNode) (map[string]bool, error) {
+	created := map[string]bool{}
+	err := ast.Walk(script, func(n ast.Node) error {
+		if node, ok := n.(*ast.CreateTableStatementNode); ok && node.Name() != nil {
+			created[pathName(node.Name())] = true
+		}
+		return nil
+	})
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
-	useExistingAlias := fmt.Sprintf("(%s) AS $1 ", replacement.ReplaceSql)
-	newSql := regexWithAlias.ReplaceAllString(sql, useExistingAlias)
-	createAlias := fmt.Sprintf("(%s) AS %s", replacement.ReplaceSql, replacement.TableShortName)
-	newSql = strings.ReplaceAll(newSql, fmt.Sprintf("%s", replacement.TableFullName), createAlias)
-	return newSql
+	return created, nil
+}
+
+/*
+Returns whether a table path names something else than a table, resolving names in the scopes enclosing it:
+a single name may be a CTE of an enclosing query,
+and a path may be rooted on an item of an enclosing FROM clause, e.g. an array column in an implicit UNNEST
+*/
+func isLocalReference(table *ast.TablePathExpressionNode) bool {
+	parts := strings.Split(pathName(table.PathExpr()), ".")
+	root := strings.ToLower(parts[0])
+	start := table.PathExpr().ParseLocationRange().Start().ByteOffset()
+	// The CTE whose body the path is in, when climbing out of a WITH clause
+	var from *ast.WithClauseEntryNode
+	for n := table.Parent(); n != nil; n = n.Parent() {
+		switch node := n.(type) {
+		case *ast.WithClauseEntryNode:
+			from = node
+		case *ast.QueryNode:
+			if len(parts) == 1 && definesCte(node.WithClause(), from, root) {
+				return true
+			}
+			from = nil
+		case *ast.SelectNode:
+			if len(parts) > 1 && node.FromClause() != nil && fromClauseAliases(node.FromClause(), start)[root] {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+/*
+Returns whether a WITH clause defines a CTE named name that is visible from the body of the CTE from,
+or from the main query when from is nil.
+A CTE covers the main query and the CTEs declared after it, a RECURSIVE clause covers all of its CTEs
+*/
+func definesCte(with *ast.WithClauseNode, from *ast.WithClauseEntryNode, name string) bool {
+	if with == nil {
+		return false
+	}
+	for _, entry := range with.With() {
+		// Entries are compared by where they start, the parse tree wraps its nodes anew on every access
+		if from != nil && !with.Recursive() && entry.ParseLocationRange().Start().ByteOffset() == from.ParseLocationRange().Start().ByteOffset() {
+			return false
+		}
+		if entry.Alias() != nil && strings.ToLower(entry.Alias().Name()) == name {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+Returns the tables a query reads from, without duplicates and sorted.
+References to CTEs, to tables the script creates and paths rooted on a table alias (e.g. an array column in an implicit UNNEST) are not tables.
+*/
+func sourceTables(sql string) ([]string, error) {
+	script, err := parseScript(sql)
+	if err != nil {
+		return nil, err
+	}
+	created, err := createdTables(script)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := map[string]bool{}
+	tables := []string{}
+	err = ast.Walk(script, func(n ast.Node) error {
+		table, ok := n.(*ast.TablePathExpressionNode)
+		if !ok || table.PathExpr() == nil {
+			return nil
+		}
+		name := pathName(table.PathExpr())
+		if created[name] || seen[name] || isLocalReference(table) {
+			return nil
+		}
+		seen[name] = true
+		tables = append(tables, name)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(tables)
+	return tables, nil
+}
+
+/*
+Checks that the mocks of a test match the tables its query reads from.
+A mock of a table the script writes to is referenced too, it holds the rows the table starts with,
+and a table the script writes to without creating it needs one like the tables it reads from.
+INFORMATION_SCHEMA views need no mock, they describe the datasets the test runs against.
+Every table without a mock and every mock the query never references is reported in a single error naming the test definition
+*/
+func checkMocks(t Test) error {
+	tables, err := sourceTables(t.FileContent)
+	if err != nil {
+		return fmt.Errorf("invalid test definition %v: %w", t.SourceFile, err)
+	}
+	script, err := parseScript(t.FileContent)
+	if err != nil {
+		return fmt.Errorf("invalid test definition %v: %w", t.SourceFile, err)
+	}
+	written, err := writtenTables(script)
+	if err != nil {
+		return fmt.Errorf("invalid test definition %v: %w", t.SourceFile, err)
+	}
+	created, err := createdTables(script)
+	if err != nil {
+		return fmt.Errorf("invalid test definition %v: %w", t.SourceFile, err)
+	}
+	read := map[string]bool{}
+	for _, table := range append(append([]string{}, tables...), written...) {
+		read[table] = true
+	}
+	mocked := map[string]bool{}
+	mockNames := []string{}
+	for tableFullName := range t.Mocks {
+		mocked[normalizeTableName(tableFullName)] = true
+		mockNames = append(mockNames, tableFullName)
+	}
+	unused := []string{}
+	for _, tableFullName := range mockNames {
+		if !read[normalizeTableName(tableFullName)] && !readByWildcard(tableFullName, tables) {
+			unused = append(unused, tableFullName)
+		}
+	}
+	sort.Strings(unused)
+	// A wildcard table is mocked by its own mock or by the mocks of its shards
+	unmocked := []string{}
+	reported := map[string]bool{}
+	for _, table := range tables {
+		if !mocked[table] && len(wildcardShards(table, mockNames)) == 0 && !isInformationSchema(table) {
+			unmocked = append(unmocked, table)
+			reported[table] = true
+		}
+	}
+	for _, table := range written {
+		if !mocked[table] && !created[table] && !reported[table] {
+			unmocked = append(unmocked, table)
+		}
+	}
+	sort.Strings(unmocked)
+
+	problems := []string{}
+	if len(unmocked) > 0 {
+		problems = append(problems, fmt.Sprintf("tables without a mock: %s", strings.Join(unmocked, ", ")))
+	}
+	if len(unused) > 0 {
+		problems = append(problems, fmt.Sprintf("mocks not referenced by the query: %s", strings.Join(unused, ", ")))
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid test definition %v: %s", t.SourceFile, strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+func parserOptions() *zetasql.ParserOptions {
+	languageOptions := zetasql.NewLanguageOptions()
+	languageOptions.EnableMaximumLanguageFeatures()
+	languageOptions.SetSupportsAllStatementKinds()
+	options := zetasql.NewParserOptions()
+	options.SetLanguageOptions(languageOptions)
+	return options
+}
+
+// Returns whether a table is an INFORMATION_SCHEMA view such as `ds.INFORMATION_SCHEMA.TABLES`
+func isInformationSchema(tableFullName string) bool {
+	for _, name := range strings.Split(normalizeTableName(tableFullName), ".") {
+		if strings.EqualFold(name, "INFORMATION_SCHEMA") {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+Returns the dotted path of a table without quoting,
+so "`project`.`dataset`.`table`", "`project.dataset.table`" and "project.dataset.table" are all the same table
+*/
+func normalizeTableName(tableFullName string) string {
+	return strings.ReplaceAll(tableFullName, "`", "")
 }
 
 /*
@@ -41,30 +380,172 @@ func queryMinusMock(sql string, m Mock) (string, error) {
 	if err != nil {
 		return "", err
 	}
-	columns := strings.Join(mockedSql.Columns, ",")
+	columns := strings.Join(comparedColumns(m, mockedSql.Columns), ",")
 	return fmt.Sprintf("SELECT %s FROM( %s ) \n  EXCEPT DISTINCT \n SELECT %s FROM (%s)", columns, sql, columns, mockedSql.Sql), nil
 }
 
+/*
+Returns the select list comparing the columns of an output.
+ARRAY and STRUCT columns, typed or listed in the schema, are compared as JSON text, since set operations and GROUP BY do not accept arrays
+*/
+func comparedColumns(m Mock, columns []string) []string {
+	// Inferred types are never nested, the declared ones are enough
+	types := columnTypes(m, nil)
+	expressions := []string{}
+	for _, column := range columns {
+		if isNestedType(types[column]) {
+			expressions = append(expressions, fmt.Sprintf("TO_JSON_STRING(%s) AS %s", column, column))
+		} else {
+			expressions = append(expressions, column)
+		}
+	}
+	return expressions
+}
+
 func tableShortName(tableFullName string) string {
 
-	parts := strings.Split(tableFullName, ".") // Split the string by dot
-	lastItem := parts[len(parts)-1]            // Get the last item
-	return lastItem
+	parts := strings.Split(normalizeTableName(tableFullName), ".") // Split the string by dot
+	lastItem := parts[len(parts)-1]                                // Get the last item
+	return fmt.Sprintf("`%s`", lastItem)
 }
 
+/*
+Returns the query under test with every mocked table replaced by its mock data.
+Each mock is materialized as a CTE of the query, so running it never reads or writes a real table
+*/
 func sql(sqlToTest string, mocks map[string]Mock) (string, error) {
-	for tablefullName, mock := range mocks {
-		mockSql, err := mockToSql(mock)
+	tableNames := []string{}
+	for tableFullName := range mocks {
+		tableNames = append(tableNames, tableFullName)
+	}
+	// Sorting keeps the generated SQL stable between runs
+	sort.Strings(tableNames)
+
+	replacements := []Replacement{}
+	ctes := []string{}
+	mocked := map[string]bool{}
+	shards := map[string]wildcardShard{}
+	for i, tablefullName := range tableNames {
+		mockSql, err := mockToSql(mocks[tablefullName])
 		if err != nil {
 			return "", err
 		}
+		cteName := fmt.Sprintf("bqt_mock_%d", i+1)
+		ctes = append(ctes, fmt.Sprintf("%s AS (%s\n)", cteName, mockSql.Sql))
 		tableShortName := tableShortName(tablefullName)
-		r := Replacement{ReplaceSql: mockSql.Sql,
+		r := Replacement{ReplaceSql: fmt.Sprintf("SELECT * FROM %s", cteName),
 			TableFullName: tablefullName, TableShortName: tableShortName}
-		sqlToTest = Replace(sqlToTest, r)
+		replacements = append(replacements, r)
+		mocked[normalizeTableName(tablefullName)] = true
+		shards[tablefullName] = wildcardShard{Cte: cteName, Columns: mockSql.Columns}
+	}
+
+	// A wildcard table without a mock of its own is the union of the mocks of its shards
+	if len(ctes) > 0 {
+		tables, err := sourceTables(sqlToTest)
+		if err != nil {
+			return "", err
+		}
+		for _, table := range tables {
+			if !isWildcardTable(table) || mocked[table] {
+				continue
+			}
+			tableShards := []wildcardShard{}
+			for _, shardName := range wildcardShards(table, tableNames) {
+				shard := shards[shardName]
+				shard.Suffix, _ = shardSuffix(table, shardName)
+				tableShards = append(tableShards, shard)
+			}
+			if len(tableShards) == 0 {
+				continue
+			}
+			wildcardRows, err := wildcardSql(table, tableShards)
+			if err != nil {
+				return "", err
+			}
+			cteName := fmt.Sprintf("bqt_wildcard_%d", len(ctes)+1)
+			ctes = append(ctes, fmt.Sprintf("%s AS (%s\n)", cteName, wildcardRows))
+			replacements = append(replacements, Replacement{ReplaceSql: fmt.Sprintf("SELECT * FROM %s", cteName),
+				TableFullName: table, TableShortName: tableShortName(table)})
+		}
+	}
+
+	if len(ctes) == 0 {
+		return sqlToTest, nil
+	}
+	offset, hasWith, err := withClauseInsertion(sqlToTest)
+	if err != nil {
+		return "", err
+	}
+	replaced, err := ReplaceAll(sqlToTest, replacements)
+	if err != nil {
+		return "", err
+	}
+	// Every table reference is after the insertion point, so the replacements did not move it
+	if hasWith {
+		return fmt.Sprintf("%s%s,\n%s", replaced[:offset], strings.Join(ctes, ",\n"), replaced[offset:]), nil
+	}
+	return fmt.Sprintf("%sWITH %s\n%s", replaced[:offset], strings.Join(ctes, ",\n"), replaced[offset:]), nil
+}
+
+/*
+Returns where the mock CTEs go in a query so that it stays the top level statement and keeps its ORDER BY.
+When the query has a WITH clause that is before its first CTE, otherwise it is the start of the query and a WITH must be added
+*/
+func withClauseInsertion(sql string) (int, bool, error) {
+	script, err := parseScript(sql)
+	if err != nil {
+		return 0, false, err
 	}
+	var query *ast.QueryNode
+	statements := 0
+	err = ast.Walk(script, func(n ast.Node) error {
+		if statement, ok := n.(*ast.QueryStatementNode); ok {
+			statements++
+			query = statement.Query()
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, false, err
+	}
+	if query == nil || statements > 1 {
+		return 0, false, errors.New("mocks can only be inlined into a single query statement")
+	}
+	if with := query.WithClause(); with != nil && len(with.With()) > 0 {
+		return with.With()[0].ParseLocationRange().Start().ByteOffset(), true, nil
+	}
+	return query.ParseLocationRange().Start().ByteOffset(), false, nil
+}
 
-	return sqlToTest, nil
+/*
+Checks that a test without targets runs a single query statement, the rows it returns are compared with the output.
+DML, DDL and scripts are tested by the tables they write to
+*/
+func checkSingleQuery(t Test) error {
+	statement, err := zetasql.ParseStatement(t.FileContent, parserOptions())
+	if err == nil {
+		if _, ok := statement.(*ast.QueryStatementNode); ok {
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid test definition %v: only a single query statement is compared with an output, "+
+		"declare the tables written by DML, DDL and scripts under targets", t.SourceFile)
+}
+
+/*
+Checks that a query only reads data: a single query statement, no DML, DDL or script.
+Cloud mode runs tests against a real project, where anything else could change its tables
+*/
+func checkReadOnly(sql string) error {
+	statement, err := zetasql.ParseStatement(sql, parserOptions())
+	if err != nil {
+		return fmt.Errorf("cloud mode only runs a single query statement: %w", err)
+	}
+	if _, ok := statement.(*ast.QueryStatementNode); !ok {
+		return errors.New("cloud mode only runs a single query statement, DML, DDL and scripts run in local mode")
+	}
+	return nil
 }
 
 func mockMinusQuery(sql string, output Mock) (string, error) {
@@ -73,10 +554,55 @@ func mockMinusQuery(sql string, output Mock) (string, error) {
 	if err != nil {
 		return "", err
 	}
-	columns := strings.Join(mockedSql.Columns, ",")
+	columns := strings.Join(comparedColumns(output, mockedSql.Columns), ",")
 	return fmt.Sprintf("SELECT %s FROM( %s ) \n  EXCEPT DISTINCT \n SELECT %s FROM (%s)", columns, mockedSql.Sql, columns, sql), nil
 }
 
+/*
+Returns a query listing the distinct rows of fromSql that appear more times than in otherSql, with both counts.
+Both sides are stacked in one relation and counted per row, so their columns are coerced to a common type
+or fail the query like a set operation would. Rows are grouped on all the columns, NULLs included,
+so a row duplicated more often than expected is reported too
+*/
+func bagMinus(fromSql string, otherSql string, columns []string, expressions []string, fromCount string, otherCount string) string {
+	expressionList := strings.Join(expressions, ", ")
+	positions := []string{}
+	for i := range columns {
+		positions = append(positions, fmt.Sprintf("%d", i+1))
+	}
+	// Grouping by position avoids mixing up a compared expression with the column it is named after
+	return fmt.Sprintf(`SELECT %s, SUM(%s) AS %s, SUM(%s) AS %s
+FROM (SELECT %s, 1 AS %s, 0 AS %s FROM (%s)
+UNION ALL SELECT %s, 0, 1 FROM (%s))
+GROUP BY %s
+HAVING SUM(%s) > SUM(%s)`,
+		strings.Join(columns, ", "), fromCount, fromCount, otherCount, otherCount,
+		expressionList, fromCount, otherCount, fromSql,
+		expressionList, otherSql,
+		strings.Join(positions, ", "),
+		fromCount, otherCount)
+}
+
+// Rows of the query output that appear more times than in the expected output
+func queryMinusMockBag(sql string, m Mock) (string, error) {
+	mockedSql, err := mockToSql(m)
+	if err != nil {
+		return "", err
+	}
+	expressions := comparedColumns(m, mockedSql.Columns)
+	return bagMinus(sql, mockedSql.Sql, mockedSql.Columns, expressions, "bqt_actual_count", "bqt_expected_count"), nil
+}
+
+// Rows of the expected output that appear more times than in the query output
+func mockMinusQueryBag(sql string, m Mock) (string, error) {
+	mockedSql, err := mockToSql(m)
+	if err != nil {
+		return "", err
+	}
+	expressions := comparedColumns(m, mockedSql.Columns)
+	return bagMinus(mockedSql.Sql, sql, mockedSql.Columns, expressions, "bqt_expected_count", "bqt_actual_count"), nil
+}
+
 func ReadContents(path string) (string, error) {
 	content, err := os.ReadFile(path)
 	if err != nil {
@@ -87,18 +613,50 @@ func ReadContents(path string) (string, error) {
 }
 
 /*
-Given a Test it generates the SQL code that mocks data, run the needed logic and asserts the output data
+Given a Test it generates the SQL code that mocks data, run the needed logic and asserts the output data.
+The targets of a script are read from the emulator tables of project, unless their name has a project of its own
 */
-func GenerateTestSQL(t Test) (SQLTestQuery, error) {
-	queryWithMockedData, err := sql(t.FileContent, t.Mocks)
+func GenerateTestSQL(t Test, project string) (SQLTestQuery, error) {
+	if err := checkMocks(t); err != nil {
+		return SQLTestQuery{}, err
+	}
+	// A script runs as it is on its mocks loaded into emulator tables
+	if isScriptTest(t) {
+		targets, err := targetQueries(t, project)
+		if err != nil {
+			return SQLTestQuery{}, err
+		}
+		return SQLTestQuery{QueryWithMockedData: t.FileContent, Targets: targets}, nil
+	}
+	if err := checkSingleQuery(t); err != nil {
+		return SQLTestQuery{}, err
+	}
+	// Materialized mocks are tables of the emulator, the query reads them as they are
+	queryWithMockedData, err := sql(t.FileContent, replacedMocks(t.Mocks))
 	if err != nil {
 		return SQLTestQuery{}, err
 	}
-	sqlQueryMinusExpectation, err := queryMinusMock(queryWithMockedData, t.Output)
+	// Only the query runs when it is expected to fail
+	if t.ExpectError != "" {
+		return SQLTestQuery{QueryWithMockedData: queryWithMockedData}, nil
+	}
+	// Ordered outputs and outputs with a tolerance are compared client side
+	if t.Output.Ordered || len(t.Output.Tolerance) > 0 {
+		orderedExpected, err := mockToOrderedSql(t.Output)
+		if err != nil {
+			return SQLTestQuery{}, err
+		}
+		return SQLTestQuery{OrderedExpected: orderedExpected, QueryWithMockedData: queryWithMockedData}, nil
+	}
+	minusExpectation, expectationMinus := queryMinusMockBag, mockMinusQueryBag
+	if t.IgnoreDuplicates {
+		minusExpectation, expectationMinus = queryMinusMock, mockMinusQuery
+	}
+	sqlQueryMinusExpectation, err := minusExpectation(queryWithMockedData, t.Output)
 	if err != nil {
 		return SQLTestQuery{}, err
 	}
-	sqlExpectationMinusQuery, err := mockMinusQuery(queryWithMockedData, t.Output)
+	sqlExpectationMinusQuery, err := expectationMinus(queryWithMockedData, t.Output)
 	if err != nil {
 		return SQLTestQuery{}, err
 	}
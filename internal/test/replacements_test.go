@@ -0,0 +1,276 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReplaceNoPreviousAlias(t *testing.T) {
+	replacement := Replacement{
+		TableFullName:  "`one`.`two`.`three`",
+		ReplaceSql:     "select * from x",
+		TableShortName: "new_table_name",
+	}
+	replaced, err := Replace("select a from `one`.`two`.`three` where a > 1", replacement)
+	assert.Nil(t, err)
+	assert.Equal(t, "select a from (select * from x) AS new_table_name where a > 1", replaced)
+}
+
+func TestReplacePreviousAlias(t *testing.T) {
+	replacement := Replacement{
+		TableFullName:  "`one`.`two`.`three`",
+		ReplaceSql:     "select * from x",
+		TableShortName: "new_table_name",
+	}
+	replaced, err := Replace("select a from `one`.`two`.`three` AS ALIAS1 where a > 1", replacement)
+	assert.Nil(t, err)
+	assert.Equal(t, "select a from (select * from x) AS ALIAS1 where a > 1", replaced)
+
+	replaced, err = Replace("select a from one.two.three ALIAS1 where a > 1", replacement)
+	assert.Nil(t, err)
+	assert.Equal(t, "select a from (select * from x) ALIAS1 where a > 1", replaced)
+}
+
+func TestReplaceIgnoresLiteralsCommentsAndPartialMatches(t *testing.T) {
+	replacement := Replacement{
+		TableFullName:  "dataset.orders",
+		ReplaceSql:     "select 1 AS a",
+		TableShortName: "`orders`",
+	}
+	sql := "-- reads dataset.orders\nselect a, 'dataset.orders' AS b from dataset.orders_v2 join `dataset.orders` using (a)"
+	replaced, err := Replace(sql, replacement)
+	assert.Nil(t, err)
+	assert.Equal(t, "-- reads dataset.orders\nselect a, 'dataset.orders' AS b from dataset.orders_v2 join (select 1 AS a) AS `orders` using (a)", replaced)
+}
+
+func TestReplaceAllSubqueriesAndDml(t *testing.T) {
+	replacements := []Replacement{
+		{TableFullName: "`ds`.`source`", ReplaceSql: "select 1 AS id", TableShortName: "`source`"},
+		{TableFullName: "ds.other", ReplaceSql: "select 2 AS id", TableShortName: "`other`"},
+	}
+	replaced, err := ReplaceAll("select id from (select id from ds.source) where id in (select id from `ds`.`other` o)", replacements)
+	assert.Nil(t, err)
+	assert.Equal(t, "select id from (select id from (select 1 AS id) AS `source`) where id in (select id from (select 2 AS id) o)", replaced)
+
+	replaced, err = ReplaceAll("insert into ds.target select id from ds.source", replacements)
+	assert.Nil(t, err)
+	assert.Equal(t, "insert into ds.target select id from (select 1 AS id) AS `source`", replaced)
+}
+
+func TestReplaceAllLocalReferences(t *testing.T) {
+	replacements := []Replacement{
+		{TableFullName: "`orders`", ReplaceSql: "select 1 AS id", TableShortName: "`orders`"},
+		{TableFullName: "o.items", ReplaceSql: "select 2 AS id", TableShortName: "`items`"},
+	}
+	// Only the table in the body of the CTE orders is the mocked table, the main query reads the CTE
+	replaced, err := ReplaceAll("with orders as (select * from `orders` where id > 0) select * from orders", replacements)
+	assert.Nil(t, err)
+	assert.Equal(t, "with orders as (select * from (select 1 AS id) AS `orders` where id > 0) select * from orders", replaced)
+
+	// o.items is the array column of the alias o, not the table o.items
+	replaced, err = ReplaceAll("select id from ds.orders o, o.items", replacements)
+	assert.Nil(t, err)
+	assert.Equal(t, "select id from ds.orders o, o.items", replaced)
+}
+
+func TestReplaceInvalidSql(t *testing.T) {
+	_, err := ReplaceAll("select from where", []Replacement{{TableFullName: "t", ReplaceSql: "select 1"}})
+	assert.NotNil(t, err)
+}
+
+func TestCheckMocks(t *testing.T) {
+	test := Test{
+		SourceFile:  "tests/orders.yaml",
+		FileContent: "with recent as (select * from `ds`.`orders` o, o.items) select * from recent join ds.customers using (id)",
+		Mocks: map[string]Mock{
+			"`ds`.`orders`":    {Filepath: "orders.csv"},
+			"`ds`.`customers`": {Filepath: "customers.csv"},
+		},
+	}
+	assert.Nil(t, checkMocks(test))
+
+	test.Mocks = map[string]Mock{
+		"`ds`.`orders`":  {Filepath: "orders.csv"},
+		"`ds`.`refunds`": {Filepath: "refunds.csv"},
+	}
+	err := checkMocks(test)
+	assert.NotNil(t, err)
+	assert.Equal(t, "invalid test definition tests/orders.yaml: tables without a mock: ds.customers; mocks not referenced by the query: `ds`.`refunds`", err.Error())
+}
+
+func TestCheckMocksAliasScopes(t *testing.T) {
+	// orders is the implicit alias of ds.orders, orders.items is its array column
+	test := Test{
+		SourceFile:  "tests/items.yaml",
+		FileContent: "select id, item from ds.orders, orders.items item",
+		Mocks:       map[string]Mock{"`ds`.`orders`": {Filepath: "orders.csv"}},
+	}
+	assert.Nil(t, checkMocks(test))
+
+	// The alias o and the CTE orders are out of scope in the second query, where o and orders are datasets
+	test.FileContent = `with orders as (select 1 as id)
+select id from ds.orders o where exists (select 1 from o.items)
+union all select id from o.refunds
+union all select id from orders
+union all select id from orders.archive`
+	test.Mocks = map[string]Mock{
+		"`ds`.`orders`":      {Filepath: "orders.csv"},
+		"`o`.`refunds`":      {Filepath: "refunds.csv"},
+		"`orders`.`archive`": {Filepath: "archive.csv"},
+	}
+	assert.Nil(t, checkMocks(test))
+
+	tables, err := sourceTables(test.FileContent)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"ds.orders", "o.refunds", "orders.archive"}, tables)
+
+	// A CTE does not cover its own body nor the CTEs declared before it, unless the clause is RECURSIVE
+	test.FileContent = `with orders as (select * from ` + "`orders`" + ` where status = 'done'),
+totals as (select id, count(*) as n from orders group by id)
+select * from totals join orders using (id)`
+	test.Mocks = map[string]Mock{"`orders`": {Filepath: "orders.csv"}}
+	assert.Nil(t, checkMocks(test))
+
+	test.FileContent = "with a as (select * from b), b as (select 1 as id) select * from a"
+	tables, err = sourceTables(test.FileContent)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"b"}, tables)
+
+	test.FileContent = "with recursive a as (select 1 as id union all select id + 1 from a where id < 3) select * from a"
+	tables, err = sourceTables(test.FileContent)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{}, tables)
+}
+
+func TestCheckMocksInformationSchema(t *testing.T) {
+	test := Test{
+		SourceFile:  "tests/tables.yaml",
+		FileContent: "select table_name from ds.INFORMATION_SCHEMA.TABLES join ds.orders on true",
+		Mocks:       map[string]Mock{"`ds`.`orders`": {Filepath: "orders.csv"}},
+	}
+	assert.Nil(t, checkMocks(test))
+
+	test.FileContent = "select job_id from `region-us`.INFORMATION_SCHEMA.JOBS, ds.orders"
+	assert.Nil(t, checkMocks(test))
+
+	test.Mocks = map[string]Mock{}
+	err := checkMocks(test)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "tables without a mock: ds.orders")
+	assert.NotContains(t, err.Error(), "INFORMATION_SCHEMA")
+}
+
+func TestCheckMocksWildcardTables(t *testing.T) {
+	test := Test{
+		SourceFile:  "tests/events.yaml",
+		FileContent: "select * from `proj.ds.events_*` where _TABLE_SUFFIX between '20240101' and '20240102'",
+		Mocks: map[string]Mock{
+			"`proj.ds.events_20240101`": {Filepath: "day1.csv"},
+			"`proj.ds.events_20240102`": {Filepath: "day2.csv"},
+		},
+	}
+	assert.Nil(t, checkMocks(test))
+
+	test.Mocks = map[string]Mock{"`proj.ds.sessions_20240101`": {Filepath: "day1.csv"}}
+	err := checkMocks(test)
+	assert.NotNil(t, err)
+	assert.Equal(t, "invalid test definition tests/events.yaml: tables without a mock: proj.ds.events_*; mocks not referenced by the query: `proj.ds.sessions_20240101`", err.Error())
+}
+
+func TestSqlWildcardTable(t *testing.T) {
+	mocks := map[string]Mock{
+		"`proj.ds.events_20240101`": {Csv: "id\n1\n", Types: map[string]string{"id": "INT64"}},
+		"`proj.ds.events_20240102`": {Csv: "id\n2\n", Types: map[string]string{"id": "INT64"}},
+	}
+	mocked, err := sql("select id from `proj.ds.events_*` where _TABLE_SUFFIX = '20240102'", mocks)
+	assert.Nil(t, err)
+	assert.Contains(t, mocked, "bqt_wildcard_3 AS (\n SELECT id, '20240101' AS _TABLE_SUFFIX FROM bqt_mock_1\n UNION ALL \n\n SELECT id, '20240102' AS _TABLE_SUFFIX FROM bqt_mock_2\n)")
+	assert.Contains(t, mocked, "select id from (SELECT * FROM bqt_wildcard_3) AS `events_*` where _TABLE_SUFFIX = '20240102'")
+}
+
+func TestCheckMocksScript(t *testing.T) {
+	test := Test{
+		SourceFile: "tests/upsert.yaml",
+		FileContent: `CREATE TEMP TABLE changed AS SELECT * FROM staging.customers WHERE updated;
+MERGE crm.customers c USING changed s ON c.id = s.id
+WHEN MATCHED THEN UPDATE SET name = s.name
+WHEN NOT MATCHED THEN INSERT (id, name) VALUES (s.id, s.name);
+INSERT INTO crm.audit SELECT id FROM changed`,
+		Mocks: map[string]Mock{
+			"`staging`.`customers`": {Filepath: "staging.csv"},
+			"`crm`.`customers`":     {Filepath: "customers.csv"},
+			"`crm`.`audit`":         {Filepath: "audit.csv"},
+		},
+	}
+	assert.Nil(t, checkMocks(test))
+
+	script, err := parseScript(test.FileContent)
+	assert.Nil(t, err)
+	written, err := writtenTables(script)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"changed", "crm.audit", "crm.customers"}, written)
+
+	// A table written without being created needs a mock holding the rows it starts with
+	delete(test.Mocks, "`crm`.`audit`")
+	err = checkMocks(test)
+	assert.NotNil(t, err)
+	assert.Equal(t, "invalid test definition tests/upsert.yaml: tables without a mock: crm.audit", err.Error())
+}
+
+func TestWithClauseInsertion(t *testing.T) {
+	offset, hasWith, err := withClauseInsertion("with a as (select 1) select * from a order by 1")
+	assert.Nil(t, err)
+	assert.True(t, hasWith)
+	assert.Equal(t, len("with "), offset)
+
+	_, _, err = withClauseInsertion("select 1; with a as (select 2) select * from a")
+	assert.NotNil(t, err)
+
+	_, _, err = withClauseInsertion("insert into ds.target select id from ds.source")
+	assert.NotNil(t, err)
+}
+
+func TestGenerateTestSQLStatementWithoutTargets(t *testing.T) {
+	source := Mock{Csv: "id\n1\n", Materialize: true}
+	target := Mock{Csv: "id\n", Materialize: true}
+	statements := map[string]map[string]Mock{
+		"insert into ds.target select id from ds.source":     {"`ds`.`source`": source, "`ds`.`target`": target},
+		"create table ds.target as select id from ds.source": {"`ds`.`source`": source},
+		"delete from ds.source where id = 1":                 {"`ds`.`source`": source},
+		"select 1 as id; select id from ds.source":           {"`ds`.`source`": source},
+	}
+	for statement, mocks := range statements {
+		test := Test{SourceFile: "tests/target.yaml", FileContent: statement, Mocks: mocks, Output: Mock{Csv: "id\n1\n"}}
+		_, err := GenerateTestSQL(test, "dummybqproject")
+		assert.NotNil(t, err, statement)
+		assert.Contains(t, err.Error(), "declare the tables written by DML, DDL and scripts under targets", statement)
+	}
+}
+
+func TestGenerateTestSQLSuiteCases(t *testing.T) {
+	tests, err := ParseFolder("testdata/suite")
+	assert.Nil(t, err)
+	for _, test := range tests {
+		_, err := GenerateTestSQL(test, "dummybqproject")
+		assert.Nil(t, err, test.Name)
+	}
+}
+
+func TestBagMinus(t *testing.T) {
+	sql := bagMinus("select a, b from x", "select a, b from y", []string{"a", "b"}, []string{"a", "TO_JSON_STRING(b) AS b"}, "bqt_actual_count", "bqt_expected_count")
+	assert.Equal(t, `SELECT a, b, SUM(bqt_actual_count) AS bqt_actual_count, SUM(bqt_expected_count) AS bqt_expected_count
+FROM (SELECT a, TO_JSON_STRING(b) AS b, 1 AS bqt_actual_count, 0 AS bqt_expected_count FROM (select a, b from x)
+UNION ALL SELECT a, TO_JSON_STRING(b) AS b, 0, 1 FROM (select a, b from y))
+GROUP BY 1, 2
+HAVING SUM(bqt_actual_count) > SUM(bqt_expected_count)`, sql)
+}
+
+func TestComparedColumns(t *testing.T) {
+	output := Mock{Types: map[string]string{"id": "INT64", "items": "ARRAY<STRUCT<id INT64>>"}}
+	assert.Equal(t, []string{"id", "TO_JSON_STRING(items) AS items", "name"}, comparedColumns(output, []string{"id", "items", "name"}))
+
+	// An empty output declares its nested columns in its schema
+	output = Mock{Schema: map[string]string{"id": "INT64", "tags": "ARRAY<STRING>"}}
+	assert.Equal(t, []string{"id", "TO_JSON_STRING(tags) AS tags"}, comparedColumns(output, []string{"id", "tags"}))
+}
@@ -0,0 +1,130 @@
+package test
+
+import (
+	"encoding/xml"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Errors   int              `xml:"errors,attr"`
+	Time     string           `xml:"time,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Errors    int             `xml:"errors,attr"`
+	Time      string          `xml:"time,attr"`
+	TestCases []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	Error     *junitFailure `xml:"error,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Content string `xml:",cdata"`
+}
+
+/*
+Converts the results of a run into a JUnit XML document, one testcase per Test.
+Failed tests carry the failure message and the tables of missing and additional records,
+tests that could not run, e.g. an invalid definition or a query error, are reported as errors instead
+*/
+func JUnitReport(results []TestResult) ([]byte, error) {
+	suite := junitTestSuite{Name: "bqt", Tests: len(results)}
+	var total time.Duration
+	for _, r := range results {
+		total += r.Duration
+		testCase := junitTestCase{
+			Name:      r.Name,
+			ClassName: r.SourceFile,
+			Time:      seconds(r.Duration),
+		}
+		switch r.Status {
+		case StatusFailed:
+			suite.Failures++
+			testCase.Failure = newJUnitFailure(r)
+		case StatusError:
+			suite.Errors++
+			testCase.Error = newJUnitFailure(r)
+		}
+		suite.TestCases = append(suite.TestCases, testCase)
+	}
+	suite.Time = seconds(total)
+	report := junitTestSuites{
+		Name:     "bqt",
+		Tests:    suite.Tests,
+		Failures: suite.Failures,
+		Errors:   suite.Errors,
+		Time:     suite.Time,
+		Suites:   []junitTestSuite{suite},
+	}
+	content, err := xml.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), content...), nil
+}
+
+// Builds the failure or error of a testcase, the tables of differing records become its content
+func newJUnitFailure(r TestResult) *junitFailure {
+	messages := []string{}
+	tables := []string{}
+	if r.Error != "" {
+		messages = append(messages, r.Error)
+	}
+	if len(r.ExtraRows.Rows) > 0 {
+		messages = append(messages, extraRowsMessage)
+		tables = append(tables, fmt.Sprintf("%s\n%s", extraRowsMessage, rowsTable(r.ExtraRows, "Additional Records")))
+	}
+	if len(r.MissingRows.Rows) > 0 {
+		messages = append(messages, missingRowsMessage)
+		tables = append(tables, fmt.Sprintf("%s\n%s", missingRowsMessage, rowsTable(r.MissingRows, "Missing Records")))
+	}
+	if r.OrderDiff != nil {
+		messages = append(messages, orderDiffMessage(*r.OrderDiff))
+		tables = append(tables, fmt.Sprintf("%s\n%s", orderDiffMessage(*r.OrderDiff), orderDiffTable(*r.OrderDiff, "<<")))
+	}
+	for _, diff := range r.TableDiffs {
+		if len(diff.ExtraRows.Rows) > 0 {
+			messages = append(messages, tableExtraRowsMessage(diff.Table))
+			tables = append(tables, fmt.Sprintf("%s\n%s", tableExtraRowsMessage(diff.Table), rowsTable(diff.ExtraRows, "Additional Records")))
+		}
+		if len(diff.MissingRows.Rows) > 0 {
+			messages = append(messages, tableMissingRowsMessage(diff.Table))
+			tables = append(tables, fmt.Sprintf("%s\n%s", tableMissingRowsMessage(diff.Table), rowsTable(diff.MissingRows, "Missing Records")))
+		}
+	}
+	return &junitFailure{Message: strings.Join(messages, "\n"), Content: strings.Join(tables, "\n\n")}
+}
+
+func seconds(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
+
+// Writes the results of a run to path in the given format, only "junit" is supported
+func WriteReport(format string, path string, results []TestResult) error {
+	if format != "junit" {
+		return fmt.Errorf("unsupported report format %q, expected junit", format)
+	}
+	content, err := JUnitReport(results)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, content, 0644)
+}
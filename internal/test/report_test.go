@@ -0,0 +1,37 @@
+package test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJUnitReport(t *testing.T) {
+	results := []TestResult{
+		{Name: "passing", SourceFile: "tests/a.yaml", Status: StatusPassed, Duration: 1500 * time.Millisecond},
+		{
+			Name:        "failing",
+			SourceFile:  "tests/b.yaml",
+			Status:      StatusFailed,
+			Duration:    500 * time.Millisecond,
+			ExtraRows:   RowSet{Columns: []string{"id"}, Rows: [][]string{{"1"}}},
+			MissingRows: RowSet{Columns: []string{"id"}, Rows: [][]string{{"2"}}},
+		},
+		{Name: "broken", SourceFile: "tests/c.yaml", Status: StatusError, Error: "failed to parse query"},
+	}
+	report, err := JUnitReport(results)
+	assert.Nil(t, err)
+	xml := string(report)
+	assert.True(t, strings.HasPrefix(xml, "<?xml"))
+	assert.Contains(t, xml, `<testsuites name="bqt" tests="3" failures="1" errors="1" time="2.000">`)
+	assert.Contains(t, xml, `<testcase name="passing" classname="tests/a.yaml" time="1.500"></testcase>`)
+	assert.Contains(t, xml, `<failure message="Query output has records not in expectation&#xA;Query output is missing expected records">`)
+	assert.Contains(t, xml, "<![CDATA[Query output has records not in expectation\n")
+	assert.Contains(t, xml, "Additional Records")
+	assert.Contains(t, xml, "Missing Records")
+	assert.Contains(t, xml, `<error message="failed to parse query">`)
+	assert.Equal(t, 1, strings.Count(xml, "<failure "))
+	assert.NotContains(t, xml, "\x1b")
+}
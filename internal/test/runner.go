@@ -6,11 +6,10 @@ import (
 	"fmt"
 	"sort"
 	"strings"
-
-	"os"
+	"sync"
+	"time"
 
 	"cloud.google.com/go/bigquery"
-	"github.com/alexeyco/simpletable"
 	"github.com/goccy/bigquery-emulator/server"
 	"github.com/goccy/bigquery-emulator/types"
 	"google.golang.org/api/googleapi"
@@ -19,32 +18,42 @@ import (
 )
 
 // COnverts each row of the csv into a sql statement
-func mockInputToSql(columnName string, value string, columnType string) string {
+func mockInputToSql(columnName string, value string, isNull bool, columnType string) (string, error) {
 
-	if value == "" {
+	if isNull {
+		value = ""
+	}
+	// ARRAY and STRUCT values are written as JSON
+	if isNestedType(columnType) {
+		literal, err := jsonToLiteral(value, columnType)
+		if err != nil {
+			return "", fmt.Errorf("column %v: %w", columnName, err)
+		}
+		return fmt.Sprintf("%s AS %s", literal, columnName), nil
+	}
+	if isNull {
 		value = "null"
 	} else {
-		value = fmt.Sprintf("\"%s\"", value)
+		value = stringLiteral(value)
 	}
 	if columnType != "" {
-		return fmt.Sprintf("CAST(%s AS %s) AS %s", value, columnType, columnName)
+		return fmt.Sprintf("CAST(%s AS %s) AS %s", value, columnType, columnName), nil
 	}
 
-	return fmt.Sprintf("%s AS %s", value, columnName)
+	return fmt.Sprintf("%s AS %s", value, columnName), nil
 
 }
 
-// Converts the mocked input into a sql query that can be injected into the sql being testes as source table
-func mockToSql(m Mock) (SQLMock, error) {
+// Converts every row of the mocked input into the list of values of a SELECT, along with the column names
+func mockSelectLists(m Mock) ([]string, []string, error) {
 
 	allColumns := []string{}
-	file, err := os.Open(m.Filepath)
+	data, err := mockData(m)
 	if err != nil {
-		return SQLMock{}, err
-
+		return nil, nil, err
 	}
-	data := CSVToMap(file)
-	var sqlStatements []string
+	types := columnTypes(m, data)
+	var selectLists []string
 	for _, row := range data {
 
 		columnsValues := []string{}
@@ -59,16 +68,79 @@ func mockToSql(m Mock) (SQLMock, error) {
 		}
 		for _, column := range columns {
 			value := row[column]
-			columnType := m.Types[column]
-			entry := mockInputToSql(column, value, columnType)
+			columnType := types[column]
+			entry, err := mockInputToSql(column, value, value == nullValue(m), columnType)
+			if err != nil {
+				return nil, nil, err
+			}
 			columnsValues = append(columnsValues, entry)
 
 		}
-		statement := fmt.Sprintf("\n SELECT %s", strings.Join(columnsValues, ", "))
+		selectLists = append(selectLists, strings.Join(columnsValues, ", "))
+	}
+	return selectLists, allColumns, nil
+}
+
+/*
+Converts a mock without rows into a typed relation with no rows, its columns come from the declared schema.
+Columns of the schema without a type are STRING
+*/
+func emptyMockToSql(m Mock) (SQLMock, error) {
+	if len(m.Schema) == 0 {
+		return SQLMock{}, errors.New("mock has no rows, declare its columns with schema")
+	}
+	columns := []string{}
+	for column := range m.Schema {
+		columns = append(columns, column)
+	}
+	sort.Strings(columns)
+	types := columnTypes(m, nil)
+	columnsValues := []string{}
+	for _, column := range columns {
+		columnType := types[column]
+		if columnType == "" {
+			columnType = "STRING"
+		}
+		columnsValues = append(columnsValues, fmt.Sprintf("CAST(NULL AS %s) AS %s", columnType, column))
+	}
+	return SQLMock{Sql: fmt.Sprintf("\n SELECT %s LIMIT 0", strings.Join(columnsValues, ", ")), Columns: columns}, nil
+}
+
+// Converts the mocked input into a sql query that can be injected into the sql being testes as source table
+func mockToSql(m Mock) (SQLMock, error) {
+	selectLists, columns, err := mockSelectLists(m)
+	if err != nil {
+		return SQLMock{}, err
+	}
+	if len(selectLists) == 0 {
+		return emptyMockToSql(m)
+	}
+	var sqlStatements []string
+	for _, selectList := range selectLists {
+		statement := fmt.Sprintf("\n SELECT %s", selectList)
 		sqlStatements = append(sqlStatements, statement)
 	}
-	return SQLMock{Sql: strings.Join(sqlStatements, "\n UNION ALL \n"), Columns: allColumns}, nil
+	return SQLMock{Sql: strings.Join(sqlStatements, "\n UNION ALL \n"), Columns: columns}, nil
+
+}
 
+// Converts the mocked input into a sql query returning its rows in the order they were declared
+func mockToOrderedSql(m Mock) (string, error) {
+	selectLists, columns, err := mockSelectLists(m)
+	if err != nil {
+		return "", err
+	}
+	if len(selectLists) == 0 {
+		empty, err := emptyMockToSql(m)
+		return empty.Sql, err
+	}
+	var sqlStatements []string
+	for i, selectList := range selectLists {
+		statement := fmt.Sprintf("\n SELECT %s, %d AS bqt_position", selectList, i+1)
+		sqlStatements = append(sqlStatements, statement)
+	}
+	return fmt.Sprintf("SELECT %s FROM (%s\n) ORDER BY bqt_position",
+		strings.Join(columns, ", "), strings.Join(sqlStatements, "\n UNION ALL \n")), nil
 }
 
 func getDetailedBigQueryError(err error) string {
@@ -87,227 +159,651 @@ func getDetailedBigQueryError(err error) string {
 	return fmt.Sprintf("Query execution failed: %v", err)
 }
 
-func RunQueryMinusExpectation(ctx context.Context, client *bigquery.Client, query string) error {
-	q := client.Query((query)) // I should make this more concise
+// Runs an assertion query with the parameters of the test and returns the records it produced
+func queryRows(ctx context.Context, client *bigquery.Client, query string, params []bigquery.QueryParameter) (RowSet, error) {
+	q := client.Query(query)
+	q.Parameters = params
 	it, err := q.Read(ctx)
 	if err != nil {
-		fmt.Println(red(fmt.Sprintf("ERROR - %s\n", getDetailedBigQueryError(err))))
-		return err
+		return RowSet{}, errors.New(getDetailedBigQueryError(err))
 	}
 
-	table := simpletable.New()
-	table.Header = &simpletable.Header{}
-	var cells [][]*simpletable.Cell
-	var columnNames []string
-
-	// Read and structure the data
-	firstRow := true
+	rows := RowSet{Columns: []string{}, Rows: [][]string{}}
 	for {
 		var row []bigquery.Value
 		if err := it.Next(&row); err != nil {
 			if err == iterator.Done {
 				break
 			}
-			return err
-		}
-
-		// Set column headers once
-		if firstRow {
-			for _, field := range it.Schema {
-				columnNames = append(columnNames, field.Name)
-				table.Header.Cells = append(table.Header.Cells, &simpletable.Cell{
-					Align: simpletable.AlignCenter, Text: field.Name,
-				})
-			}
-			firstRow = false
+			return RowSet{}, errors.New(getDetailedBigQueryError(err))
 		}
 
-		var rowCells []*simpletable.Cell
+		values := []string{}
 		for _, value := range row {
-			rowCells = append(rowCells, &simpletable.Cell{
-				Text: fmt.Sprintf("%v", value),
-			})
+			values = append(values, fmt.Sprintf("%v", value))
 		}
-		cells = append(cells, rowCells)
+		rows.Rows = append(rows.Rows, values)
+	}
+	// The schema is known once the iterator started, an empty result still has columns
+	for _, field := range it.Schema {
+		rows.Columns = append(rows.Columns, field.Name)
 	}
+	return rows, nil
+}
 
-	if len(cells) == 0 {
-		return nil
+/*
+Calls fn for every index in [0, count) using at most parallel goroutines and returns once all calls are done.
+With parallel of 1 or less the calls happen sequentially, in order
+*/
+func runConcurrently(count int, parallel int, fn func(i int)) {
+	if parallel <= 1 {
+		for i := 0; i < count; i++ {
+			fn(i)
+		}
+		return
+	}
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < parallel && w < count; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				fn(i)
+			}
+		}()
+	}
+	for i := 0; i < count; i++ {
+		jobs <- i
 	}
+	close(jobs)
+	wg.Wait()
+}
 
-	table.Body = &simpletable.Body{Cells: cells}
+/*
+Calls first and second, at the same time when the run has a free query slot, one after the other otherwise.
+The test calling it holds a slot already, so a run never has more than config.Parallel queries in flight.
+A local run has no slots, its emulators serve one request at a time
+*/
+func runPair(config RunConfig, first func(), second func()) {
+	select {
+	case config.slots <- struct{}{}:
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-config.slots }()
+			second()
+		}()
+		first()
+		wg.Wait()
+	default:
+		first()
+		second()
+	}
+}
 
-	table.Footer = &simpletable.Footer{
-		Cells: []*simpletable.Cell{
-			{Align: simpletable.AlignCenter, Span: len(columnNames), Text: yellow("Additional Records")},
-		},
+// Runs a statement that returns no rows, such as a DML statement or a script, and waits for it to complete
+func execStatement(ctx context.Context, client *bigquery.Client, statement string, params []bigquery.QueryParameter) error {
+	q := client.Query(statement)
+	q.Parameters = params
+	job, err := q.Run(ctx)
+	if err != nil {
+		return errors.New(getDetailedBigQueryError(err))
+	}
+	status, err := job.Wait(ctx)
+	if err != nil {
+		return errors.New(getDetailedBigQueryError(err))
 	}
+	if err := status.Err(); err != nil {
+		return errors.New(getDetailedBigQueryError(err))
+	}
+	return nil
+}
 
-	table.SetStyle(simpletable.StyleDefault)
-	table.Println()
+/*
+Starts an emulator of its own for a test, holding a table for each mock loaded with the mock rows.
+Returns a client connected to it, the function stopping it, and the statements that loaded the rows.
+The emulator takes one of the run's emulator slots until it is stopped, so a run never starts more of them than it has workers
+*/
+func materializeMocks(ctx context.Context, config RunConfig, mocks map[string]Mock) (*bigquery.Client, func(), []string, error) {
+	if config.Mode != "local" {
+		return nil, nil, nil, errors.New("materialized mocks and scripts are only supported in local mode")
+	}
+	release := func() {}
+	if config.emulators != nil {
+		config.emulators <- struct{}{}
+		release = func() { <-config.emulators }
+	}
+	tables := map[tablePath][]structField{}
+	inserts := []string{}
+	for tableFullName, m := range mocks {
+		path, err := parseTablePath(tableFullName, emulatorProject(config))
+		if err != nil {
+			release()
+			return nil, nil, nil, err
+		}
+		columns, err := materializedColumns(m)
+		if err != nil {
+			release()
+			return nil, nil, nil, fmt.Errorf("materialized mock %v: %w", tableFullName, err)
+		}
+		tables[path] = columns
+		insert, err := insertMockSql(path, m)
+		if err != nil {
+			release()
+			return nil, nil, nil, fmt.Errorf("materialized mock %v: %w", tableFullName, err)
+		}
+		if insert != "" {
+			inserts = append(inserts, insert)
+		}
+	}
+	// Sorting keeps the reported setup stable between runs
+	sort.Strings(inserts)
 
-	// Print the error message
-	errorMsg := "Query output has records not in expectation"
-	fmt.Println(red(fmt.Sprintf("ERROR - %s\n", errorMsg)))
-	return errors.New(errorMsg)
+	client, stop, err := newLocalClient(ctx, config, tables)
+	if err != nil {
+		release()
+		return nil, nil, nil, err
+	}
+	stopAll := func() {
+		client.Close()
+		stop()
+		release()
+	}
+	for _, insert := range inserts {
+		if err := execStatement(ctx, client, insert, nil); err != nil {
+			stopAll()
+			return nil, nil, inserts, err
+		}
+	}
+	return client, stopAll, inserts, nil
 }
 
-func RunExpectationMinusQuery(ctx context.Context, client *bigquery.Client, query string) error {
-	it, err := client.Query(query).Read(ctx)
+// Dry runs a query and returns the bytes it would scan, an invalid query fails here already
+func dryRunBytes(ctx context.Context, client *bigquery.Client, query string, params []bigquery.QueryParameter) (int64, error) {
+	q := client.Query(query)
+	q.Parameters = params
+	q.DryRun = true
+	job, err := q.Run(ctx)
 	if err != nil {
-		fmt.Println(red(fmt.Sprintf("ERROR - %s\n", getDetailedBigQueryError(err))))
-		return err
+		return 0, errors.New(getDetailedBigQueryError(err))
 	}
+	status := job.LastStatus()
+	if status == nil || status.Statistics == nil {
+		return 0, nil
+	}
+	return status.Statistics.TotalBytesProcessed, nil
+}
 
-	table := simpletable.New()
-	table.Header = &simpletable.Header{}
-	var cells [][]*simpletable.Cell
-	var columnNames []string
+/*
+Fails if a query would scan more than maxBytes according to its dry run.
+Mocked queries only read literals, so any scanned byte comes from a real table the test forgot to mock
+*/
+func checkQueryCost(processed int64, maxBytes int64) error {
+	if processed > maxBytes {
+		return fmt.Errorf("query would process %d bytes, more than the limit of %d bytes", processed, maxBytes)
+	}
+	return nil
+}
 
-	// Read and structure the data
-	firstRow := true
-	for {
-		var row []bigquery.Value
-		if err := it.Next(&row); err != nil {
-			if err == iterator.Done {
-				break
-			}
-			return err
+/*
+Generates the SQL of a test, runs both assertions and records the outcome.
+With a parallel run the two assertion queries run at the same time, in cloud mode the query is dry run first
+*/
+func runTest(ctx context.Context, client *bigquery.Client, config RunConfig, t Test) TestResult {
+	start := time.Now()
+	result := TestResult{Name: t.Name, SourceFile: t.SourceFile}
+
+	// Nothing that could write to the real project reaches it, not even a dry run
+	if config.Mode == "cloud" {
+		if err := checkReadOnly(t.FileContent); err != nil {
+			result.Status = StatusError
+			result.Error = fmt.Sprintf("invalid test definition %v: %s", t.SourceFile, err)
+			result.Duration = time.Since(start)
+			return result
 		}
+	}
 
-		// Set column headers once
-		if firstRow {
-			for _, field := range it.Schema {
-				columnNames = append(columnNames, field.Name)
-				table.Header.Cells = append(table.Header.Cells, &simpletable.Cell{
-					Align: simpletable.AlignCenter, Text: field.Name,
-				})
-			}
-			firstRow = false
-		}
+	sqlQueries, err := GenerateTestSQL(t, emulatorProject(config))
+	if err != nil {
+		result.Status = StatusError
+		result.Error = err.Error()
+		result.Duration = time.Since(start)
+		return result
+	}
+	result.SQL = sqlQueries
 
-		// Populate the table with row values
-		var rowCells []*simpletable.Cell
-		for _, value := range row {
-			rowCells = append(rowCells, &simpletable.Cell{
-				Text: fmt.Sprintf("%v", value),
-			})
+	params, err := queryParameters(t.Params)
+	if err != nil {
+		result.Status = StatusError
+		result.Error = err.Error()
+		result.Duration = time.Since(start)
+		return result
+	}
+
+	// A script, or a test with materialized mocks, runs on an emulator of its own loaded with their tables
+	if isScriptTest(t) || hasMaterializedMocks(t) {
+		materializedClient, stop, setup, err := materializeMocks(ctx, config, materializedMocks(t))
+		result.SQL.Setup = setup
+		if err != nil {
+			result.Status = StatusError
+			result.Error = err.Error()
+			result.Duration = time.Since(start)
+			return result
 		}
-		cells = append(cells, rowCells)
+		defer stop()
+		client = materializedClient
 	}
 
-	// If no missing data, exit early
-	if len(cells) == 0 {
-		return nil
+	// Both assertions read the same mocked query, dry running it once is enough
+	if config.Mode == "cloud" {
+		processed, err := dryRunBytes(ctx, client, sqlQueries.QueryWithMockedData, params)
+		// The error a query is expected to fail with may already come from its dry run
+		if err != nil && t.ExpectError != "" {
+			return expectedErrorResult(err, t.ExpectError, result, start)
+		}
+		if err == nil {
+			err = checkQueryCost(processed, config.MaxBytesProcessed)
+		}
+		if err != nil {
+			result.Status = StatusError
+			result.Error = err.Error()
+			result.Duration = time.Since(start)
+			return result
+		}
 	}
 
-	table.Body = &simpletable.Body{Cells: cells}
+	if isScriptTest(t) {
+		return runScriptTest(ctx, client, sqlQueries, params, t.ExpectError, result, start)
+	}
+	if t.ExpectError != "" {
+		return runExpectedErrorTest(ctx, client, sqlQueries, params, t.ExpectError, result, start)
+	}
+	if t.Output.Ordered {
+		return runOrderedTest(ctx, client, config, sqlQueries, params, t.Output.Tolerance, result, start)
+	}
+	if len(t.Output.Tolerance) > 0 {
+		return runToleranceTest(ctx, client, config, sqlQueries, params, t.Output.Tolerance, result, start)
+	}
 
-	// Footer indicating issue
-	table.Footer = &simpletable.Footer{
-		Cells: []*simpletable.Cell{
-			{Align: simpletable.AlignCenter, Span: len(columnNames), Text: yellow("Missing Records")},
-		},
+	var (
+		extraRows, missingRows            RowSet
+		unexpectedDataErr, missingDataErr error
+	)
+	runPair(config, func() {
+		// Checking for unexpected data
+		extraRows, unexpectedDataErr = queryRows(ctx, client, sqlQueries.QueryMinusExpected, params)
+	}, func() {
+		// Check for missing data
+		missingRows, missingDataErr = queryRows(ctx, client, sqlQueries.ExpectedMinusQuery, params)
+	})
+	result.ExtraRows = extraRows
+	result.MissingRows = missingRows
+
+	switch {
+	case unexpectedDataErr != nil || missingDataErr != nil:
+		result.Status = StatusError
+		result.Error = errors.Join(unexpectedDataErr, missingDataErr).Error()
+	case len(extraRows.Rows) > 0 || len(missingRows.Rows) > 0:
+		result.Status = StatusFailed
+	default:
+		result.Status = StatusPassed
 	}
+	result.Duration = time.Since(start)
+	return result
+}
 
-	table.SetStyle(simpletable.StyleDefault)
-	table.Println()
+// Returns the project of the emulator, dummybqproject unless configured
+func emulatorProject(config RunConfig) string {
+	if config.Project == "" {
+		return "dummybqproject"
+	}
+	return config.Project
+}
 
-	// Print the error message immediately after the table
-	errorMsg := "Query output is missing expected records"
-	fmt.Println(red(fmt.Sprintf("ERROR - %s\n", errorMsg)))
-	return errors.New(errorMsg)
+// Converts a column type into the column of an emulator table, an ARRAY is a repeated column of its element type
+func emulatorColumn(name string, t *sqlType) *types.Column {
+	switch {
+	case t.Elem != nil:
+		column := emulatorColumn(name, t.Elem)
+		column.Mode = types.RepeatedMode
+		return column
+	case t.Fields != nil:
+		fields := []*types.Column{}
+		for _, f := range t.Fields {
+			fields = append(fields, emulatorColumn(f.Name, f.Type))
+		}
+		return types.NewColumn(name, types.STRUCT, types.ColumnFields(fields...))
+	}
+	// Parameters such as the precision of NUMERIC(10, 2) are not part of the emulator type
+	scalar := strings.ToUpper(t.Name)
+	if i := strings.IndexByte(scalar, '('); i >= 0 {
+		scalar = scalar[:i]
+	}
+	return types.NewColumn(name, types.Type(scalar))
 }
 
-func RunTests(mode string, tests []Test) error {
-	ctx := context.Background()
-	const (
-		projectID = "dummybqproject"
-		datasetID = "dataset1"
-		routineID = "routine1"
-	)
+/*
+Starts an in-process emulator and returns a client connected to it, the returned function stops the emulator.
+The emulator holds the configured project and datasets, dummybqproject and dataset1 by default,
+and the given tables, created empty
+*/
+func newLocalClient(ctx context.Context, config RunConfig, tables map[tablePath][]structField) (*bigquery.Client, func(), error) {
+	projectID := emulatorProject(config)
+	datasetIDs := config.Datasets
+	if len(datasetIDs) == 0 {
+		datasetIDs = []string{"dataset1"}
+	}
+	// Projects and datasets keyed by id, tables may live in datasets or projects of their own
+	projects := map[string]map[string][]*types.Table{projectID: {}}
+	for _, datasetID := range datasetIDs {
+		projects[projectID][datasetID] = nil
+	}
+	for path, columns := range tables {
+		if projects[path.Project] == nil {
+			projects[path.Project] = map[string][]*types.Table{}
+		}
+		emulatorColumns := []*types.Column{}
+		for _, column := range columns {
+			emulatorColumns = append(emulatorColumns, emulatorColumn(column.Name, column.Type))
+		}
+		projects[path.Project][path.Dataset] = append(projects[path.Project][path.Dataset],
+			types.NewTable(path.Table, emulatorColumns, nil))
+	}
+	sources := []*types.Project{}
+	for id, datasetTables := range projects {
+		datasets := []*types.Dataset{}
+		for datasetID, tables := range datasetTables {
+			datasets = append(datasets, types.NewDataset(datasetID, tables...))
+		}
+		sources = append(sources, types.NewProject(id, datasets...))
+	}
+
 	bqServer, err := server.New(server.TempStorage)
 	if err != nil {
-		return err
-	}
-	if err := bqServer.Load(
-		server.StructSource(
-			types.NewProject(
-				projectID,
-				types.NewDataset(
-					datasetID,
-				),
-			),
-		),
-	); err != nil {
-		return err
+		return nil, nil, err
+	}
+	if err := bqServer.Load(server.StructSource(sources...)); err != nil {
+		bqServer.Close()
+		return nil, nil, err
 	}
 	if err := bqServer.SetProject(projectID); err != nil {
-		return err
+		bqServer.Close()
+		return nil, nil, err
 	}
 	testServer := bqServer.TestServer()
-	defer testServer.Close()
-
-	var client *bigquery.Client
-	if mode == "local" {
-		client, err = bigquery.NewClient(
-			ctx,
-			projectID,
-			option.WithEndpoint(testServer.URL),
-			option.WithoutAuthentication(),
-		)
-	} else {
-		client, err = bigquery.NewClient(
-			ctx,
-			projectID,
-		)
+	stop := func() {
+		testServer.Close()
+		bqServer.Close()
 	}
 
+	client, err := bigquery.NewClient(
+		ctx,
+		projectID,
+		option.WithEndpoint(testServer.URL),
+		option.WithoutAuthentication(),
+	)
 	if err != nil {
-		return err
+		stop()
+		return nil, nil, err
 	}
-	defer client.Close()
+	return client, stop, nil
+}
 
-	var lastErr error = nil
-	var failures int = 0
-	var failedTests []string
+/*
+Returns a client for the BigQuery API of the configured project.
+Credentials come from Application Default Credentials, unless an endpoint override points to a stand-in server
+*/
+func newCloudClient(ctx context.Context, config RunConfig) (*bigquery.Client, error) {
+	if config.Project == "" {
+		return nil, errors.New("cloud mode requires a project")
+	}
+	options := []option.ClientOption{}
+	if config.Endpoint != "" {
+		options = append(options, option.WithEndpoint(config.Endpoint), option.WithoutAuthentication())
+	}
+	client, err := bigquery.NewClient(ctx, config.Project, options...)
+	if err != nil {
+		return nil, err
+	}
+	client.Location = config.Location
+	return client, nil
+}
 
-	for _, t := range tests {
-		fmt.Println("")
-		fmt.Println(fmt.Sprintf("Running Test: %+v : %+v", t.Name, t.SourceFile))
-		sqlQueries, err := GenerateTestSQL(t)
+// Fetches the rows of the query, in query order, and the expected rows, in the order they were declared
+func fetchActualAndExpected(ctx context.Context, client *bigquery.Client, config RunConfig, sqlQueries SQLTestQuery, params []bigquery.QueryParameter) (RowSet, RowSet, error) {
+	var (
+		actual, expected       RowSet
+		actualErr, expectedErr error
+	)
+	runPair(config, func() {
+		actual, actualErr = queryRows(ctx, client, sqlQueries.QueryWithMockedData, params)
+	}, func() {
+		// The expected rows are literals, they do not read any parameter
+		expected, expectedErr = queryRows(ctx, client, sqlQueries.OrderedExpected, nil)
+	})
+	if err := errors.Join(actualErr, expectedErr); err != nil {
+		return RowSet{}, RowSet{}, err
+	}
+	return actual, expected, nil
+}
 
+// Fetches the rows of the query and of the expected output, in order, and compares them position by position
+func runOrderedTest(ctx context.Context, client *bigquery.Client, config RunConfig, sqlQueries SQLTestQuery, params []bigquery.QueryParameter, tolerances map[string]Tolerance, result TestResult, start time.Time) TestResult {
+	actual, expected, err := fetchActualAndExpected(ctx, client, config, sqlQueries, params)
+	var diff *OrderDiff
+	if err == nil {
+		diff, err = compareOrdered(expected, actual, tolerances)
+	}
+	switch {
+	case err != nil:
+		result.Status = StatusError
+		result.Error = err.Error()
+	case diff != nil:
+		result.Status = StatusFailed
+		result.OrderDiff = diff
+	default:
+		result.Status = StatusPassed
+	}
+	result.Duration = time.Since(start)
+	return result
+}
+
+// Runs the query and passes only when it fails with an error matching the expected one
+func runExpectedErrorTest(ctx context.Context, client *bigquery.Client, sqlQueries SQLTestQuery, params []bigquery.QueryParameter, expectError string, result TestResult, start time.Time) TestResult {
+	_, err := queryRows(ctx, client, sqlQueries.QueryWithMockedData, params)
+	return expectedErrorResult(err, expectError, result, start)
+}
+
+// Records whether the query failed with an error matching the expected one
+func expectedErrorResult(err error, expectError string, result TestResult, start time.Time) TestResult {
+	switch {
+	case err == nil:
+		result.Status = StatusFailed
+		result.Error = fmt.Sprintf("query succeeded, expected an error matching %q", expectError)
+	case !errorMatches(err.Error(), expectError):
+		result.Status = StatusFailed
+		result.Error = fmt.Sprintf("query failed with %q, expected an error matching %q", err.Error(), expectError)
+	default:
+		result.Status = StatusPassed
+	}
+	result.Duration = time.Since(start)
+	return result
+}
+
+/*
+Runs the script of a test, then compares each of its target tables with their expected rows.
+When the script is expected to fail its targets are not compared
+*/
+func runScriptTest(ctx context.Context, client *bigquery.Client, sqlQueries SQLTestQuery, params []bigquery.QueryParameter, expectError string, result TestResult, start time.Time) TestResult {
+	err := execStatement(ctx, client, sqlQueries.QueryWithMockedData, params)
+	if expectError != "" {
+		return expectedErrorResult(err, expectError, result, start)
+	}
+	if err != nil {
+		result.Status = StatusError
+		result.Error = err.Error()
+		result.Duration = time.Since(start)
+		return result
+	}
+
+	targetErrs := []error{}
+	for _, target := range sqlQueries.Targets {
+		// The targets are tables, their contents do not read any parameter
+		extraRows, unexpectedDataErr := queryRows(ctx, client, target.QueryMinusExpected, nil)
+		missingRows, missingDataErr := queryRows(ctx, client, target.ExpectedMinusQuery, nil)
+		if err := errors.Join(unexpectedDataErr, missingDataErr); err != nil {
+			targetErrs = append(targetErrs, fmt.Errorf("target %v: %w", target.Table, err))
+			continue
+		}
+		if len(extraRows.Rows) > 0 || len(missingRows.Rows) > 0 {
+			result.TableDiffs = append(result.TableDiffs, TableDiff{Table: target.Table, ExtraRows: extraRows, MissingRows: missingRows})
+		}
+	}
+
+	switch {
+	case len(targetErrs) > 0:
+		result.Status = StatusError
+		result.Error = errors.Join(targetErrs...).Error()
+	case len(result.TableDiffs) > 0:
+		result.Status = StatusFailed
+	default:
+		result.Status = StatusPassed
+	}
+	result.Duration = time.Since(start)
+	return result
+}
+
+/*
+Fetches the rows of the query and of the expected output and matches them client side,
+numeric columns with a tolerance match when they are close enough
+*/
+func runToleranceTest(ctx context.Context, client *bigquery.Client, config RunConfig, sqlQueries SQLTestQuery, params []bigquery.QueryParameter, tolerances map[string]Tolerance, result TestResult, start time.Time) TestResult {
+	actual, expected, err := fetchActualAndExpected(ctx, client, config, sqlQueries, params)
+	if err == nil {
+		result.ExtraRows, result.MissingRows, err = matchRows(expected, actual, tolerances)
+	}
+	switch {
+	case err != nil:
+		result.Status = StatusError
+		result.Error = err.Error()
+	case len(result.ExtraRows.Rows) > 0 || len(result.MissingRows.Rows) > 0:
+		result.Status = StatusFailed
+	default:
+		result.Status = StatusPassed
+	}
+	result.Duration = time.Since(start)
+	return result
+}
+
+/*
+BigQuery clients that run tests, connected to in-process emulators in local mode.
+The emulator serves one request at a time, so local mode starts an emulator for each of config.Parallel workers,
+cloud mode shares a single client.
+A Runner is meant to run several batches of tests, e.g. in watch mode, Close stops its emulators
+*/
+type Runner struct {
+	config  RunConfig
+	clients []*bigquery.Client
+	stops   []func()
+}
+
+func NewRunner(config RunConfig) (*Runner, error) {
+	ctx := context.Background()
+	runner := &Runner{config: config}
+	switch config.Mode {
+	case "local":
+		for i := 0; i < max(config.Parallel, 1); i++ {
+			client, stop, err := newLocalClient(ctx, config, nil)
+			if err != nil {
+				runner.Close()
+				return nil, err
+			}
+			runner.clients = append(runner.clients, client)
+			runner.stops = append(runner.stops, stop)
+		}
+	case "cloud":
+		client, err := newCloudClient(ctx, config)
 		if err != nil {
-			return err
+			return nil, err
 		}
-		// Checking for unexpected data
-		unexpectedDataErr := RunQueryMinusExpectation(ctx, client, sqlQueries.QueryMinusExpected)
+		runner.clients = []*bigquery.Client{client}
+	default:
+		return nil, fmt.Errorf("unsupported mode %q, expected local or cloud", config.Mode)
+	}
+	return runner, nil
+}
 
-		// Check for missing data
-		missingDataErr := RunExpectationMinusQuery(ctx, client, sqlQueries.ExpectedMinusQuery)
-
-		// Combine the errors
-		testErr := errors.Join(unexpectedDataErr, missingDataErr)
-
-		if testErr == nil {
-			fmt.Println(green(fmt.Sprintf("Test Success: %+v : %+v\n", t.Name, t.SourceFile)))
-		} else {
-			fmt.Println(red(fmt.Sprintf("Test Failed: %+v : %+v\n", t.Name, t.SourceFile)))
-			failures++
-			failedTests = append(failedTests, t.Name)
-			lastErr = testErr
+/*
+Runs the tests and returns the result of every test, in the order of tests.
+In local mode each running test has an emulator of its own,
+a test with materialized mocks or a script starts another one in one of config.Parallel emulator slots.
+In cloud mode up to config.Parallel queries run at the same time: each running test holds a query slot,
+and runs its assertion queries side by side only with a slot no other test uses
+*/
+func (r *Runner) Run(tests []Test) []TestResult {
+	ctx := context.Background()
+	config := r.config
+	parallel := max(config.Parallel, 1)
+	if config.Mode == "cloud" {
+		config.slots = make(chan struct{}, parallel)
+	}
+	if config.Mode == "local" {
+		config.emulators = make(chan struct{}, parallel)
+	}
+	// A worker takes a client for the time of a test, the cloud client is shared by all of them
+	clients := make(chan *bigquery.Client, parallel)
+	for i := 0; i < parallel; i++ {
+		clients <- r.clients[i%len(r.clients)]
+	}
+	// Every worker writes its own slot, so results keep the order of tests
+	results := make([]TestResult, len(tests))
+	runConcurrently(len(tests), config.Parallel, func(i int) {
+		client := <-clients
+		defer func() { clients <- client }()
+		if config.slots != nil {
+			config.slots <- struct{}{}
+			defer func() { <-config.slots }()
 		}
+		results[i] = runTest(ctx, client, config, tests[i])
+	})
+	return results
+}
+
+func (r *Runner) Close() {
+	for _, client := range r.clients {
+		client.Close()
+	}
+	for _, stop := range r.stops {
+		stop()
 	}
+}
 
-	// Test Summary
-	fmt.Printf("\nTest Summary: %d tests run, %d passed, %d failed\n",
-		len(tests), len(tests)-failures, failures)
+/*
+Runs the tests against the emulator (or the cloud) and returns the result of every test, in the order of tests.
+Failing tests do not make it return an error, only failing to set up the BigQuery client does
+*/
+func RunTests(config RunConfig, tests []Test) ([]TestResult, error) {
+	runner, err := NewRunner(config)
+	if err != nil {
+		return nil, err
+	}
+	defer runner.Close()
+	return runner.Run(tests), nil
+}
 
-	// Return an error if any of the tests failed
-	if failures > 0 {
+// Returns an error naming every test that did not pass, or nil when all of them passed
+func Failures(results []TestResult) error {
+	var failedTests []string
+	for _, r := range results {
+		if r.Status != StatusPassed {
+			failedTests = append(failedTests, r.Name)
+		}
+	}
+	if len(failedTests) > 0 {
 		return fmt.Errorf("- %d of %d tests failed: %s",
-			failures, len(tests), strings.Join(failedTests, ", "))
+			len(failedTests), len(results), strings.Join(failedTests, ", "))
 	}
-
-	return lastErr
+	return nil
 }
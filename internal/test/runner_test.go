@@ -0,0 +1,178 @@
+package test
+
+import (
+	"context"
+	"math"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/goccy/bigquery-emulator/server"
+	"github.com/goccy/bigquery-emulator/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunConcurrently(t *testing.T) {
+	var running, maxRunning int32
+	var mu sync.Mutex
+	seen := []int{}
+	runConcurrently(10, 3, func(i int) {
+		n := atomic.AddInt32(&running, 1)
+		for {
+			max := atomic.LoadInt32(&maxRunning)
+			if n <= max || atomic.CompareAndSwapInt32(&maxRunning, max, n) {
+				break
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+		atomic.AddInt32(&running, -1)
+		mu.Lock()
+		seen = append(seen, i)
+		mu.Unlock()
+	})
+	assert.ElementsMatch(t, []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}, seen)
+	assert.LessOrEqual(t, maxRunning, int32(3))
+	assert.Greater(t, maxRunning, int32(1))
+
+	order := []int{}
+	runConcurrently(4, 1, func(i int) {
+		order = append(order, i)
+	})
+	assert.Equal(t, []int{0, 1, 2, 3}, order)
+}
+
+func TestEmptyMockToSql(t *testing.T) {
+	mocked, err := mockToSql(Mock{
+		Csv:    "id,name,tags\n",
+		Schema: map[string]string{"id": "INT64", "name": "", "tags": "ARRAY<STRING>"},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"id", "name", "tags"}, mocked.Columns)
+	assert.Equal(t, "\n SELECT CAST(NULL AS INT64) AS id, CAST(NULL AS STRING) AS name, CAST(NULL AS ARRAY<STRING>) AS tags LIMIT 0", mocked.Sql)
+
+	_, err = mockToSql(Mock{Csv: "id\n"})
+	assert.NotNil(t, err)
+}
+
+func TestRunPair(t *testing.T) {
+	// Without a free slot the calls run one after the other, in order
+	config := RunConfig{Parallel: 1, slots: make(chan struct{}, 1)}
+	config.slots <- struct{}{}
+	order := []string{}
+	runPair(config, func() { order = append(order, "first") }, func() { order = append(order, "second") })
+	assert.Equal(t, []string{"first", "second"}, order)
+
+	// With a free slot they overlap, and the slot is released afterwards
+	config = RunConfig{Parallel: 2, slots: make(chan struct{}, 2)}
+	config.slots <- struct{}{}
+	started := make(chan bool)
+	runPair(config, func() { <-started }, func() {
+		assert.Equal(t, 2, len(config.slots))
+		started <- true
+	})
+	assert.Equal(t, 1, len(config.slots))
+}
+
+/*
+Runs a test in cloud mode against an emulator standing in for the BigQuery API.
+The emulator runs a dry run as a real query and reports the size of its result as the bytes processed,
+so the cost guard, only meaningful on BigQuery, is lifted here
+*/
+func TestMaterializeMocksEmulatorSlots(t *testing.T) {
+	config := RunConfig{Mode: "local", Parallel: 1, emulators: make(chan struct{}, 1)}
+	mocks := map[string]Mock{"`shop`.`orders`": {Csv: "id\n1\n", Types: map[string]string{"id": "INT64"}, Materialize: true}}
+	_, stop, _, err := materializeMocks(context.Background(), config, mocks)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(config.emulators))
+	stop()
+	assert.Equal(t, 0, len(config.emulators))
+
+	// A mock that cannot be materialized gives its slot back
+	_, _, _, err = materializeMocks(context.Background(), config, map[string]Mock{"orders": {Csv: "id\n1\n"}})
+	assert.NotNil(t, err)
+	assert.Equal(t, 0, len(config.emulators))
+}
+
+func TestRunTestsCloudMode(t *testing.T) {
+	bqServer, err := server.New(server.TempStorage)
+	assert.Nil(t, err)
+	defer bqServer.Close()
+	assert.Nil(t, bqServer.Load(server.StructSource(types.NewProject("cloudproject", types.NewDataset("dataset1")))))
+	assert.Nil(t, bqServer.SetProject("cloudproject"))
+	testServer := bqServer.TestServer()
+	defer testServer.Close()
+
+	tests := []Test{{
+		Name:        "doubled",
+		SourceFile:  "tests/doubled.yaml",
+		FileContent: "SELECT id * 2 AS doubled FROM `shop`.`orders`",
+		Mocks:       map[string]Mock{"`shop`.`orders`": {Csv: "id\n1\n2\n", Types: map[string]string{"id": "INT64"}}},
+		Output:      Mock{Csv: "doubled\n2\n4\n", Types: map[string]string{"doubled": "INT64"}},
+	}, {
+		// The dry run already fails, with the expected error
+		Name:        "negative",
+		SourceFile:  "tests/negative.yaml",
+		FileContent: "SELECT IF(amount < 0, ERROR('negative amount'), amount) AS amount FROM `shop`.`orders`",
+		Mocks:       map[string]Mock{"`shop`.`orders`": {Csv: "amount\n-5\n", Types: map[string]string{"amount": "INT64"}}},
+		ExpectError: "negative amount",
+	}, {
+		// A statement writing to the project is rejected before its dry run, whatever error it expects
+		Name:        "archive",
+		SourceFile:  "tests/archive.yaml",
+		FileContent: "INSERT INTO `shop`.`archive` SELECT id FROM `shop`.`orders`",
+		Mocks:       map[string]Mock{"`shop`.`orders`": {Csv: "id\n1\n", Types: map[string]string{"id": "INT64"}}},
+		ExpectError: "archive",
+	}}
+	config := RunConfig{Mode: "cloud", Project: "cloudproject", Endpoint: testServer.URL, Parallel: 1, MaxBytesProcessed: math.MaxInt64}
+	results, err := RunTests(config, tests)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(results))
+	assert.Equal(t, StatusPassed, results[0].Status, results[0].Error)
+	assert.Equal(t, StatusPassed, results[1].Status, results[1].Error)
+	assert.Equal(t, StatusError, results[2].Status)
+	assert.Contains(t, results[2].Error, "cloud mode only runs a single query statement")
+}
+
+func TestCheckReadOnly(t *testing.T) {
+	assert.Nil(t, checkReadOnly("WITH o AS (SELECT 1 AS id) SELECT id FROM o ORDER BY id"))
+	for _, sql := range []string{
+		"DELETE FROM ds.orders WHERE TRUE",
+		"UPDATE ds.orders SET id = 1 WHERE TRUE",
+		"INSERT INTO ds.archive SELECT * FROM ds.orders",
+		"CREATE TABLE ds.archive AS SELECT * FROM ds.orders",
+		"SELECT 1; DROP TABLE ds.orders",
+	} {
+		assert.NotNil(t, checkReadOnly(sql), sql)
+	}
+}
+
+func TestCheckQueryCost(t *testing.T) {
+	assert.Nil(t, checkQueryCost(0, 0))
+	assert.Nil(t, checkQueryCost(100, 100))
+	err := checkQueryCost(101, 100)
+	assert.NotNil(t, err)
+	assert.Equal(t, "query would process 101 bytes, more than the limit of 100 bytes", err.Error())
+}
+
+// An empty expected output still has the columns of its schema, so its tolerances apply to known columns
+func TestRunTestsEmptyOutputWithTolerance(t *testing.T) {
+	tests := []Test{{
+		Name:        "no-orders",
+		SourceFile:  "tests/no_orders.yaml",
+		FileContent: "SELECT AVG(amount) AS avg_amount FROM `shop`.`orders` GROUP BY customer_id",
+		Mocks: map[string]Mock{"`shop`.`orders`": {
+			Csv:    "customer_id,amount\n",
+			Schema: map[string]string{"customer_id": "INT64", "amount": "FLOAT64"},
+		}},
+		Output: Mock{
+			Csv:       "avg_amount\n",
+			Schema:    map[string]string{"avg_amount": "FLOAT64"},
+			Tolerance: map[string]Tolerance{"avg_amount": {Absolute: 0.01}},
+		},
+	}}
+	results, err := RunTests(RunConfig{Mode: "local", Parallel: 1}, tests)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(results))
+	assert.Equal(t, StatusPassed, results[0].Status, results[0].Error)
+}
@@ -0,0 +1,51 @@
+package test
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Returns whether a test runs its file as a script and checks the tables it writes to, instead of the rows of a query
+func isScriptTest(t Test) bool {
+	return len(t.Targets) > 0
+}
+
+/*
+Returns the queries comparing each target table of a script test with its expected rows, sorted by table.
+The whole table is read from the emulator table its mock is loaded into, project being the emulator's,
+and only the columns of its expectation are compared, like the output of a query
+*/
+func targetQueries(t Test, project string) ([]TargetQuery, error) {
+	tables := []string{}
+	for table := range t.Targets {
+		tables = append(tables, table)
+	}
+	sort.Strings(tables)
+
+	minusExpectation, expectationMinus := queryMinusMockBag, mockMinusQueryBag
+	if t.IgnoreDuplicates {
+		minusExpectation, expectationMinus = queryMinusMock, mockMinusQuery
+	}
+	queries := []TargetQuery{}
+	for _, table := range tables {
+		target := t.Targets[table]
+		if target.Ordered || len(target.Tolerance) > 0 {
+			return nil, fmt.Errorf("target %v: ordered and tolerance are not supported on the targets of a script", table)
+		}
+		path, err := parseTablePath(table, project)
+		if err != nil {
+			return nil, fmt.Errorf("target %v: %w", table, err)
+		}
+		contents := fmt.Sprintf("SELECT * FROM %s", path.String())
+		queryMinusExpected, err := minusExpectation(contents, target)
+		if err != nil {
+			return nil, fmt.Errorf("target %v: %w", table, err)
+		}
+		expectedMinusQuery, err := expectationMinus(contents, target)
+		if err != nil {
+			return nil, fmt.Errorf("target %v: %w", table, err)
+		}
+		queries = append(queries, TargetQuery{Table: table, QueryMinusExpected: queryMinusExpected, ExpectedMinusQuery: expectedMinusQuery})
+	}
+	return queries, nil
+}
@@ -0,0 +1,37 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTargetQueries(t *testing.T) {
+	test := Test{
+		Mocks: map[string]Mock{"`crm`.`customers`": {Csv: "id\n1\n"}, "`staging`.`customers`": {Csv: "id\n2\n"}},
+		Targets: map[string]Mock{
+			"`crm`.`customers`": {Csv: "id\n1\n2\n"},
+			"`crm`.`audit`":     {Csv: "id\n2\n"},
+		},
+	}
+	assert.True(t, isScriptTest(test))
+	assert.False(t, isScriptTest(Test{Mocks: test.Mocks}))
+	assert.Equal(t, 2, len(materializedMocks(test)))
+
+	queries, err := targetQueries(test, "dummybqproject")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(queries))
+	assert.Equal(t, "`crm`.`audit`", queries[0].Table)
+	assert.Equal(t, "`crm`.`customers`", queries[1].Table)
+	assert.Contains(t, queries[0].QueryMinusExpected, "FROM (SELECT * FROM `dummybqproject`.`crm`.`audit`)")
+
+	// A target named with its own project is read from it, whether its name is quoted or not
+	test.Targets = map[string]Mock{"my-project.crm.audit": {Csv: "id\n2\n"}}
+	queries, err = targetQueries(test, "dummybqproject")
+	assert.Nil(t, err)
+	assert.Contains(t, queries[0].QueryMinusExpected, "FROM (SELECT * FROM `my-project`.`crm`.`audit`)")
+
+	test.Targets["`crm`.`audit`"] = Mock{Csv: "id\n2\n", Ordered: true}
+	_, err = targetQueries(test, "dummybqproject")
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,228 @@
+package test
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// A parsed BigQuery type, Elem is set for ARRAY and Fields for STRUCT, other types are scalars named by Name
+type sqlType struct {
+	Name   string
+	Elem   *sqlType
+	Fields []structField
+}
+
+type structField struct {
+	Name string
+	Type *sqlType
+}
+
+func (t *sqlType) String() string {
+	switch {
+	case t.Elem != nil:
+		return fmt.Sprintf("ARRAY<%s>", t.Elem)
+	case t.Fields != nil:
+		fields := []string{}
+		for _, f := range t.Fields {
+			fields = append(fields, fmt.Sprintf("%s %s", f.Name, f.Type))
+		}
+		return fmt.Sprintf("STRUCT<%s>", strings.Join(fields, ", "))
+	}
+	return t.Name
+}
+
+// Returns whether a declared column type is an ARRAY or a STRUCT, whose values are written as JSON
+func isNestedType(columnType string) bool {
+	upper := strings.ToUpper(strings.TrimSpace(columnType))
+	return strings.HasPrefix(upper, "ARRAY") || strings.HasPrefix(upper, "STRUCT")
+}
+
+type typeParser struct {
+	input string
+	pos   int
+}
+
+// Parses a type declaration such as ARRAY<STRUCT<id INT64, tags ARRAY<STRING>>>
+func parseType(declaration string) (*sqlType, error) {
+	p := &typeParser{input: declaration}
+	t, err := p.parseType()
+	if err != nil {
+		return nil, fmt.Errorf("invalid type %q: %w", declaration, err)
+	}
+	p.skipSpaces()
+	if p.pos != len(p.input) {
+		return nil, fmt.Errorf("invalid type %q: unexpected %q", declaration, p.input[p.pos:])
+	}
+	return t, nil
+}
+
+func (p *typeParser) skipSpaces() {
+	for p.pos < len(p.input) && unicode.IsSpace(rune(p.input[p.pos])) {
+		p.pos++
+	}
+}
+
+func (p *typeParser) identifier() string {
+	p.skipSpaces()
+	start := p.pos
+	for p.pos < len(p.input) {
+		c := rune(p.input[p.pos])
+		if !unicode.IsLetter(c) && !unicode.IsDigit(c) && c != '_' {
+			break
+		}
+		p.pos++
+	}
+	return p.input[start:p.pos]
+}
+
+func (p *typeParser) expect(symbol byte) error {
+	p.skipSpaces()
+	if p.pos >= len(p.input) || p.input[p.pos] != symbol {
+		return fmt.Errorf("expected %q at position %d", symbol, p.pos)
+	}
+	p.pos++
+	return nil
+}
+
+func (p *typeParser) peek(symbol byte) bool {
+	p.skipSpaces()
+	return p.pos < len(p.input) && p.input[p.pos] == symbol
+}
+
+func (p *typeParser) parseType() (*sqlType, error) {
+	name := p.identifier()
+	if name == "" {
+		return nil, fmt.Errorf("expected a type name at position %d", p.pos)
+	}
+	switch strings.ToUpper(name) {
+	case "ARRAY":
+		if err := p.expect('<'); err != nil {
+			return nil, err
+		}
+		elem, err := p.parseType()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect('>'); err != nil {
+			return nil, err
+		}
+		return &sqlType{Name: "ARRAY", Elem: elem}, nil
+	case "STRUCT":
+		if err := p.expect('<'); err != nil {
+			return nil, err
+		}
+		t := &sqlType{Name: "STRUCT", Fields: []structField{}}
+		for {
+			fieldName := p.identifier()
+			if fieldName == "" {
+				return nil, fmt.Errorf("expected a field name at position %d", p.pos)
+			}
+			fieldType, err := p.parseType()
+			if err != nil {
+				return nil, err
+			}
+			t.Fields = append(t.Fields, structField{Name: fieldName, Type: fieldType})
+			if !p.peek(',') {
+				break
+			}
+			p.pos++
+		}
+		if err := p.expect('>'); err != nil {
+			return nil, err
+		}
+		return t, nil
+	}
+	// Parameterized scalars such as NUMERIC(10, 2) keep their parameters as written
+	if p.peek('(') {
+		end := strings.IndexByte(p.input[p.pos:], ')')
+		if end < 0 {
+			return nil, errors.New("unclosed type parameters")
+		}
+		name += p.input[p.pos : p.pos+end+1]
+		p.pos += end + 1
+	}
+	return &sqlType{Name: name}, nil
+}
+
+/*
+Converts a JSON value into a BigQuery literal of the given type.
+Arrays and structs become typed ARRAY<...>[...] and STRUCT<...>(...) literals, scalars are cast from their text
+*/
+func nestedLiteral(value interface{}, t *sqlType) (string, error) {
+	if value == nil {
+		return fmt.Sprintf("CAST(NULL AS %s)", t), nil
+	}
+	switch {
+	case t.Elem != nil:
+		items, ok := value.([]interface{})
+		if !ok {
+			return "", fmt.Errorf("expected a JSON array for %s, got %v", t, value)
+		}
+		literals := []string{}
+		for _, item := range items {
+			literal, err := nestedLiteral(item, t.Elem)
+			if err != nil {
+				return "", err
+			}
+			literals = append(literals, literal)
+		}
+		return fmt.Sprintf("%s[%s]", t, strings.Join(literals, ", ")), nil
+	case t.Fields != nil:
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return "", fmt.Errorf("expected a JSON object for %s, got %v", t, value)
+		}
+		known := map[string]bool{}
+		literals := []string{}
+		for _, f := range t.Fields {
+			known[f.Name] = true
+			literal, err := nestedLiteral(object[f.Name], f.Type)
+			if err != nil {
+				return "", err
+			}
+			literals = append(literals, literal)
+		}
+		for key := range object {
+			if !known[key] {
+				return "", fmt.Errorf("field %v is not part of %s", key, t)
+			}
+		}
+		return fmt.Sprintf("%s(%s)", t, strings.Join(literals, ", ")), nil
+	}
+
+	var text string
+	switch v := value.(type) {
+	case string:
+		text = v
+	case json.Number:
+		text = v.String()
+	case bool:
+		text = fmt.Sprintf("%t", v)
+	default:
+		return "", fmt.Errorf("expected a scalar for %s, got %v", t, value)
+	}
+	if strings.EqualFold(t.Name, "STRING") {
+		return stringLiteral(text), nil
+	}
+	return fmt.Sprintf("CAST(%s AS %s)", stringLiteral(text), t), nil
+}
+
+// Converts a value written as JSON, e.g. in a CSV cell, into a literal of a nested type
+func jsonToLiteral(value string, columnType string) (string, error) {
+	t, err := parseType(columnType)
+	if err != nil {
+		return "", err
+	}
+	var decoded interface{}
+	if value != "" {
+		decoder := json.NewDecoder(strings.NewReader(value))
+		decoder.UseNumber()
+		if err := decoder.Decode(&decoded); err != nil {
+			return "", fmt.Errorf("invalid JSON value %q for %s: %w", value, t, err)
+		}
+	}
+	return nestedLiteral(decoded, t)
+}
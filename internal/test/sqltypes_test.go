@@ -0,0 +1,35 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseType(t *testing.T) {
+	parsed, err := parseType("array<struct<id int64, tags ARRAY<STRING>, price NUMERIC(10, 2)>>")
+	assert.Nil(t, err)
+	assert.Equal(t, "ARRAY<STRUCT<id int64, tags ARRAY<STRING>, price NUMERIC(10, 2)>>", parsed.String())
+
+	_, err = parseType("ARRAY<INT64")
+	assert.NotNil(t, err)
+	_, err = parseType("STRUCT<INT64>")
+	assert.NotNil(t, err)
+}
+
+func TestJsonToLiteral(t *testing.T) {
+	literal, err := jsonToLiteral(`[{"id": 1, "tags": ["a", "b\""]}, {"id": null, "tags": []}]`, "ARRAY<STRUCT<id INT64, tags ARRAY<STRING>>>")
+	assert.Nil(t, err)
+	assert.Equal(t, `ARRAY<STRUCT<id INT64, tags ARRAY<STRING>>>[`+
+		`STRUCT<id INT64, tags ARRAY<STRING>>(CAST("1" AS INT64), ARRAY<STRING>["a", "b\""]), `+
+		`STRUCT<id INT64, tags ARRAY<STRING>>(CAST(NULL AS INT64), ARRAY<STRING>[])]`, literal)
+
+	literal, err = jsonToLiteral("", "ARRAY<INT64>")
+	assert.Nil(t, err)
+	assert.Equal(t, "CAST(NULL AS ARRAY<INT64>)", literal)
+
+	_, err = jsonToLiteral(`{"id": 1, "other": 2}`, "STRUCT<id INT64>")
+	assert.NotNil(t, err)
+	_, err = jsonToLiteral(`[1,`, "ARRAY<INT64>")
+	assert.NotNil(t, err)
+}
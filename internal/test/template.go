@@ -0,0 +1,132 @@
+package test
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"text/template"
+)
+
+var (
+	templateAction = regexp.MustCompile(`(?s){{.*?}}`)
+	// A dbt style call such as ref('orders') or source('raw', 'orders'), with quoted arguments only
+	templateCall = regexp.MustCompile(`\b(\w+)\(\s*((?:'[^']*'|"[^"]*")(?:\s*,\s*(?:'[^']*'|"[^"]*"))*)?\s*\)`)
+	quotedArg    = regexp.MustCompile(`'[^']*'|"[^"]*"`)
+	// A dbt config block such as {{ config(materialized='table') }}, it only tells dbt how to build the model
+	configAction = regexp.MustCompile(`(?s){{-?\s*config\(.*?\)\s*-?}}\n?`)
+	// A Jinja if tag such as {% if is_incremental() %}, {% else %} or {%- endif -%}
+	jinjaIfTag = regexp.MustCompile(`(?s){%(-?)\s*(if|elif|else|endif)\b(.*?)(-?)%}`)
+	// The start of a dbt call or Jinja if tag, telling a templated query from plain SQL
+	dbtTemplate = regexp.MustCompile(`{{-?\s*(ref|source|var)\(|{%-?\s*if\b`)
+)
+
+// The Go template keyword of each Jinja if tag
+var jinjaKeywords = map[string]string{"if": "if", "elif": "else if", "else": "else", "endif": "end"}
+
+/*
+Rewrites the dbt style calls of every template action into Go template calls,
+e.g. {{ source('raw', 'orders') }} becomes {{ (source "raw" "orders") }}.
+Config blocks are dropped and Jinja if tags become Go template actions,
+so that {% if is_incremental() %} becomes {{ if (is_incremental) }}
+*/
+func dbtToGoTemplate(sql string) string {
+	sql = configAction.ReplaceAllString(sql, "")
+	sql = jinjaIfTag.ReplaceAllStringFunc(sql, func(tag string) string {
+		match := jinjaIfTag.FindStringSubmatch(tag)
+		action := strings.TrimSpace(jinjaKeywords[match[2]] + " " + strings.TrimSpace(match[3]))
+		return fmt.Sprintf("{{%s %s %s}}", match[1], action, match[4])
+	})
+	return templateAction.ReplaceAllStringFunc(sql, func(action string) string {
+		return templateCall.ReplaceAllStringFunc(action, func(call string) string {
+			match := templateCall.FindStringSubmatch(call)
+			args := []string{match[1]}
+			for _, arg := range quotedArg.FindAllString(match[2], -1) {
+				args = append(args, fmt.Sprintf("%q", arg[1:len(arg)-1]))
+			}
+			return "(" + strings.Join(args, " ") + ")"
+		})
+	})
+}
+
+/*
+Returns the template functions of a test, ref and source resolve to the table names mocks are declared with
+and var returns one of the test's vars, funcs adds to or overrides them.
+A test always builds a model from scratch, so is_incremental is false
+*/
+func templateFuncs(vars map[string]interface{}, funcs template.FuncMap) template.FuncMap {
+	all := template.FuncMap{
+		// ref('model') or ref('package', 'model'), the package does not change the table name
+		"ref": func(args ...string) (string, error) {
+			if len(args) == 0 || len(args) > 2 {
+				return "", fmt.Errorf("ref takes a model and an optional package, got %d arguments", len(args))
+			}
+			return fmt.Sprintf("`%s`", args[len(args)-1]), nil
+		},
+		"source": func(source string, table string) string {
+			return fmt.Sprintf("`%s`.`%s`", source, table)
+		},
+		"var": func(name string) (interface{}, error) {
+			value, ok := vars[name]
+			if !ok {
+				return nil, fmt.Errorf("var %q is not defined", name)
+			}
+			return value, nil
+		},
+		"is_incremental": func() bool {
+			return false
+		},
+	}
+	for name, fn := range funcs {
+		all[name] = fn
+	}
+	return all
+}
+
+/*
+Renders the SQL of a test as a Go template, vars are available as {{ .name }} or {{ var "name" }}.
+dbt style calls with quoted arguments, such as {{ ref('orders') }}, are accepted too
+*/
+func renderSQL(sql string, vars map[string]interface{}, funcs template.FuncMap) (string, error) {
+	tmpl, err := template.New("sql").
+		Funcs(templateFuncs(vars, funcs)).
+		Option("missingkey=error").
+		Parse(dbtToGoTemplate(sql))
+	if err != nil {
+		return "", err
+	}
+	var rendered strings.Builder
+	if err := tmpl.Execute(&rendered, vars); err != nil {
+		return "", err
+	}
+	return rendered.String(), nil
+}
+
+/*
+Returns whether the SQL of a test is a template: the test declares vars or a dbt model, or its SQL calls ref, source or var
+or has a Jinja if tag. Plain SQL may contain {{ in a string literal, it is never parsed as a template
+*/
+func isTemplated(t Test) bool {
+	return len(t.Vars) > 0 || t.Model != "" || dbtTemplate.MatchString(t.FileContent)
+}
+
+/*
+Renders the templated SQL of every test before its SQL is generated, the SQL of other tests is left as it is.
+funcs adds template functions or replaces the default ref, source and var, e.g. to resolve ref from a dbt project
+*/
+func RenderTemplates(tests []Test, funcs template.FuncMap) error {
+	for i := range tests {
+		if !isTemplated(tests[i]) {
+			continue
+		}
+		rendered, err := renderSQL(tests[i].FileContent, tests[i].Vars, funcs)
+		if err != nil && tests[i].Model != "" {
+			return fmt.Errorf("failed to render model %v of test %v, run `dbt compile` to test its compiled SQL instead: %w",
+				tests[i].Model, tests[i].Name, err)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to render %v of test %v: %w", tests[i].File, tests[i].Name, err)
+		}
+		tests[i].FileContent = rendered
+	}
+	return nil
+}
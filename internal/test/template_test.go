@@ -0,0 +1,54 @@
+package test
+
+import (
+	"fmt"
+	"testing"
+	"text/template"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRenderSQL(t *testing.T) {
+	sql := "SELECT * FROM {{ ref('orders') }} JOIN {{ source('raw', \"customers\") }} USING (id)" +
+		" WHERE day >= '{{ var('start') }}'{{ if .only_paid }} AND paid{{ end }}"
+	rendered, err := renderSQL(sql, map[string]interface{}{"start": "2024-01-01", "only_paid": true}, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "SELECT * FROM `orders` JOIN `raw`.`customers` USING (id) WHERE day >= '2024-01-01' AND paid", rendered)
+
+	rendered, err = renderSQL("SELECT 1 FROM {{ ref \"orders\" }}", nil, template.FuncMap{
+		"ref": func(model string) string { return fmt.Sprintf("`analytics`.`%s`", model) },
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "SELECT 1 FROM `analytics`.`orders`", rendered)
+
+	_, err = renderSQL("SELECT {{ var('missing') }}", nil, nil)
+	assert.NotNil(t, err)
+	_, err = renderSQL("SELECT {{ .missing }}", map[string]interface{}{}, nil)
+	assert.NotNil(t, err)
+}
+
+func TestRenderSQLDbtModel(t *testing.T) {
+	sql := "{{ config(materialized='incremental') }}\nSELECT * FROM {{ ref('shop', 'orders') }}" +
+		"{%- if is_incremental() %} WHERE day > '{{ var('start') }}'{% else %} WHERE TRUE{% endif %}"
+	rendered, err := renderSQL(sql, map[string]interface{}{"start": "2024-01-01"}, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "SELECT * FROM `orders` WHERE TRUE", rendered)
+
+	_, err = renderSQL("SELECT * FROM {{ ref('a', 'b', 'c') }}", nil, nil)
+	assert.NotNil(t, err)
+}
+
+func TestRenderTemplates(t *testing.T) {
+	tests := []Test{{Name: "t", FileContent: "SELECT {{ .n }}", Vars: map[string]interface{}{"n": uint64(3)}}}
+	assert.Nil(t, RenderTemplates(tests, nil))
+	assert.Equal(t, "SELECT 3", tests[0].FileContent)
+
+	// Plain SQL is not a template, even with braces in a string literal
+	tests = []Test{{Name: "t", FileContent: "SELECT '{{literal}}' AS a, REGEXP_CONTAINS(b, r'x{2}') FROM ds.t"}}
+	assert.Nil(t, RenderTemplates(tests, nil))
+	assert.Equal(t, "SELECT '{{literal}}' AS a, REGEXP_CONTAINS(b, r'x{2}') FROM ds.t", tests[0].FileContent)
+
+	tests = []Test{{Name: "t", FileContent: "SELECT * FROM {{ ref('orders') }}"}}
+	assert.Nil(t, RenderTemplates(tests, nil))
+	assert.Equal(t, "SELECT * FROM `orders`", tests[0].FileContent)
+}
@@ -0,0 +1 @@
+select id from `dataset`.`users`
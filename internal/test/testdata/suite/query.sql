@@ -0,0 +1 @@
+select id, name from `dataset`.`users` join `dataset`.`groups` using (id)
@@ -1,21 +1,81 @@
 package test
 
+import "time"
+
+/*
+InferTypes guesses the type of the columns missing from Types out of their values.
+NullMarker is the value meaning NULL, when set empty values are empty strings, otherwise empty values are NULLs.
+Schema declares every column with its type, it is required for a mock without rows and fills in Types otherwise.
+Materialize loads the mock into a table of the emulator instead of replacing the table in the query.
+Ordered and Tolerance only apply to a test output.
+Ordered compares its rows in order with the rows of the query, Tolerance lets numeric columns differ slightly
+*/
 type Mock struct {
-	Filepath string            `yaml:"filepath"`
-	Types    map[string]string `yaml:"types"`
+	Filepath    string                   `yaml:"filepath"`
+	Rows        []map[string]interface{} `yaml:"rows"`
+	Csv         string                   `yaml:"csv"`
+	Types       map[string]string        `yaml:"types"`
+	Schema      map[string]string        `yaml:"schema"`
+	InferTypes  bool                     `yaml:"infer_types"`
+	Materialize bool                     `yaml:"materialize"`
+	NullMarker  *string                  `yaml:"null_marker"`
+	Ordered     bool                     `yaml:"ordered"`
+	Tolerance   map[string]Tolerance     `yaml:"tolerance"`
+}
+
+// Two numbers match when they differ by at most Absolute, or by at most Relative times the expected value
+type Tolerance struct {
+	Absolute float64 `yaml:"absolute"`
+	Relative float64 `yaml:"relative"`
 }
 
 type Output struct {
 	Name string `yaml:"name"`
 }
 
+/*
+By default the output is compared as a bag, counting duplicates, IgnoreDuplicates compares it as a set instead.
+A test with ExpectError passes when the query fails with a message containing or matching it, its output is ignored.
+Params are the named parameters of the query, such as @run_date.
+Vars are the values of a templated query, see RenderTemplates.
+Model names a dbt model whose SQL, read from the dbt manifest, is tested instead of File.
+Tags select the tests to run, the tags of a suite apply to all its cases.
+A test with Targets runs File as a script, such as DML statements, on its mocks loaded into emulator tables,
+and compares the final contents of each target table with its expected rows instead of an output
+*/
 type Test struct {
-	SourceFile  string
-	Name        string          `yaml:"name"`
-	File        string          `yaml:"file"`
-	Mocks       map[string]Mock `yaml:"mocks"`
-	Output      Mock            `yaml:"output"`
-	FileContent string
+	SourceFile       string
+	Name             string                 `yaml:"name"`
+	File             string                 `yaml:"file"`
+	Model            string                 `yaml:"model"`
+	Mocks            map[string]Mock        `yaml:"mocks"`
+	Output           Mock                   `yaml:"output"`
+	IgnoreDuplicates bool                   `yaml:"ignore_duplicates"`
+	ExpectError      string                 `yaml:"expect_error"`
+	Params           map[string]Param       `yaml:"params"`
+	Vars             map[string]interface{} `yaml:"vars"`
+	Tags             []string               `yaml:"tags"`
+	Targets          map[string]Mock        `yaml:"targets"`
+	FileContent      string
+}
+
+// A named query parameter, Type is a scalar type such as DATE or INT64, or an ARRAY of one
+type Param struct {
+	Type  string      `yaml:"type"`
+	Value interface{} `yaml:"value"`
+}
+
+// A Suite declares the model SQL and default mocks once, and a list of cases
+// that override some of the mocks and supply their own output
+type Suite struct {
+	Test  `yaml:",inline"`
+	Cases []Test `yaml:"cases"`
+}
+
+// The settings of a case that may turn a suite setting off as well as on, nil when the case keeps the suite's
+type caseSettings struct {
+	IgnoreDuplicates *bool   `yaml:"ignore_duplicates"`
+	ExpectError      *string `yaml:"expect_error"`
 }
 
 type SQLMock struct {
@@ -29,8 +89,100 @@ type Replacement struct {
 	TableShortName string
 }
 
+// A table path found in a query, Start and End are the byte offsets of the path
+type TableReference struct {
+	Name     string
+	Start    int
+	End      int
+	HasAlias bool
+}
+
+/*
+The queries of a test, Setup are the statements loading its materialized mocks.
+Targets compare the tables a script writes to with their expected rows
+*/
 type SQLTestQuery struct {
-	ExpectedMinusQuery  string
-	QueryMinusExpected  string
-	QueryWithMockedData string
+	ExpectedMinusQuery  string        `json:"expected_minus_query,omitempty"`
+	QueryMinusExpected  string        `json:"query_minus_expected,omitempty"`
+	QueryWithMockedData string        `json:"query_with_mocked_data"`
+	OrderedExpected     string        `json:"ordered_expected,omitempty"`
+	Setup               []string      `json:"setup,omitempty"`
+	Targets             []TargetQuery `json:"targets,omitempty"`
+}
+
+// The queries comparing a table written by a script with its expected rows
+type TargetQuery struct {
+	Table              string `json:"table"`
+	ExpectedMinusQuery string `json:"expected_minus_query"`
+	QueryMinusExpected string `json:"query_minus_expected"`
+}
+
+/*
+Settings of a test run.
+Mode is either "local", running on an in-process emulator, or "cloud", running on the BigQuery API of Project.
+In local mode the emulator holds Project and Datasets.
+Endpoint overrides the BigQuery API URL in cloud mode, MaxBytesProcessed is the most a cloud query may scan according to its dry run.
+Parallel is the number of tests running at the same time, each on an emulator of its own in local mode.
+In cloud mode it is the most queries a run has in flight, tests and their assertion queries share that limit
+*/
+type RunConfig struct {
+	Mode              string
+	Project           string
+	Datasets          []string
+	Location          string
+	Endpoint          string
+	Parallel          int
+	MaxBytesProcessed int64
+	// Query slots of a cloud run, see runPair
+	slots chan struct{}
+	// Emulator slots of a local run, one per worker, see materializeMocks
+	emulators chan struct{}
+}
+
+const (
+	StatusPassed = "passed"
+	StatusFailed = "failed"
+	StatusError  = "error"
+)
+
+// Records returned by one of the assertion queries, values are formatted as text
+type RowSet struct {
+	Columns []string   `json:"columns"`
+	Rows    [][]string `json:"rows"`
+}
+
+/*
+The rows of an ordered output and of the query, side by side.
+Position is the first row, counting from 1, where they diverge
+*/
+type OrderDiff struct {
+	Position int        `json:"position"`
+	Columns  []string   `json:"columns"`
+	Expected [][]string `json:"expected"`
+	Actual   [][]string `json:"actual"`
+}
+
+/*
+The outcome of running a single Test.
+ExtraRows are records of the query output not in the expectation, MissingRows are expected records the query did not return.
+TableDiffs hold the target tables of a script whose contents differ from their expectation
+*/
+type TestResult struct {
+	Name        string        `json:"name"`
+	SourceFile  string        `json:"source_file"`
+	Status      string        `json:"status"`
+	Duration    time.Duration `json:"duration"`
+	SQL         SQLTestQuery  `json:"sql"`
+	ExtraRows   RowSet        `json:"extra_rows"`
+	MissingRows RowSet        `json:"missing_rows"`
+	OrderDiff   *OrderDiff    `json:"order_diff,omitempty"`
+	TableDiffs  []TableDiff   `json:"table_diffs,omitempty"`
+	Error       string        `json:"error,omitempty"`
+}
+
+// The records of a target table not in its expectation, and its expected records missing from the table
+type TableDiff struct {
+	Table       string `json:"table"`
+	ExtraRows   RowSet `json:"extra_rows"`
+	MissingRows RowSet `json:"missing_rows"`
 }
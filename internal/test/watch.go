@@ -0,0 +1,172 @@
+package test
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/goccy/go-yaml"
+)
+
+// Returns the files a test is defined by: its YAML, its SQL and the CSV files of its mocks, output and targets
+func TestFiles(t Test) []string {
+	files := []string{t.SourceFile}
+	if t.File != "" {
+		files = append(files, t.File)
+	}
+	for _, m := range t.Mocks {
+		if m.Filepath != "" {
+			files = append(files, m.Filepath)
+		}
+	}
+	if t.Output.Filepath != "" {
+		files = append(files, t.Output.Filepath)
+	}
+	for _, target := range t.Targets {
+		if target.Filepath != "" {
+			files = append(files, target.Filepath)
+		}
+	}
+	return files
+}
+
+/*
+Returns the files a test definition references, every file and filepath value of its raw YAML at any depth.
+They are known even when the definition fails to parse, e.g. because the CSV it points to is malformed
+*/
+func referencedFiles(path string) []string {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	var definition interface{}
+	if err := yaml.Unmarshal(content, &definition); err != nil {
+		return nil
+	}
+	files := []string{}
+	var visit func(value interface{})
+	visit = func(value interface{}) {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			for key, child := range v {
+				if file, ok := child.(string); ok && (key == "file" || key == "filepath") && file != "" {
+					files = append(files, file)
+				}
+				visit(child)
+			}
+		case []interface{}:
+			for _, child := range v {
+				visit(child)
+			}
+		}
+	}
+	visit(definition)
+	return files
+}
+
+/*
+Returns every file to watch for changes, the files of the tests and the YAML files under rootPath
+with the files they reference, so adding a test definition or fixing one that failed to parse is noticed too
+*/
+func WatchedFiles(rootPath string, tests []Test) ([]string, error) {
+	seen := map[string]bool{}
+	for _, t := range tests {
+		for _, file := range TestFiles(t) {
+			seen[filepath.Clean(file)] = true
+		}
+	}
+	err := filepath.WalkDir(rootPath, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() && strings.HasSuffix(strings.ToLower(d.Name()), ".yaml") && d.Name() != ConfigFileName {
+			seen[filepath.Clean(path)] = true
+			for _, file := range referencedFiles(path) {
+				seen[filepath.Clean(file)] = true
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	files := []string{}
+	for file := range seen {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+/*
+Polls the modification time of files.
+A file is changed when it was modified, created or removed since the previous call to Changed
+*/
+type Watcher struct {
+	modified map[string]time.Time
+}
+
+func NewWatcher() *Watcher {
+	return &Watcher{modified: map[string]time.Time{}}
+}
+
+// Returns the files whose modification time differs from the last time they were checked, sorted
+func (w *Watcher) Changed(files []string) []string {
+	changed := []string{}
+	current := map[string]time.Time{}
+	for _, file := range files {
+		var modified time.Time
+		if info, err := os.Stat(file); err == nil {
+			modified = info.ModTime()
+		}
+		current[file] = modified
+		if previous, ok := w.modified[file]; !ok || !previous.Equal(modified) {
+			changed = append(changed, file)
+		}
+	}
+	for file := range w.modified {
+		if _, ok := current[file]; !ok {
+			changed = append(changed, file)
+		}
+	}
+	w.modified = current
+	sort.Strings(changed)
+	return changed
+}
+
+/*
+Starts watching the files not watched yet, as of their current modification time.
+The files already watched keep the time they were last checked at, so changes since then are still reported
+*/
+func (w *Watcher) Add(files []string) {
+	for _, file := range files {
+		if _, ok := w.modified[file]; ok {
+			continue
+		}
+		var modified time.Time
+		if info, err := os.Stat(file); err == nil {
+			modified = info.ModTime()
+		}
+		w.modified[file] = modified
+	}
+}
+
+// Returns the tests defined by one of the changed files
+func AffectedTests(tests []Test, changed []string) []Test {
+	isChanged := map[string]bool{}
+	for _, file := range changed {
+		isChanged[filepath.Clean(file)] = true
+	}
+	affected := []Test{}
+	for _, t := range tests {
+		for _, file := range TestFiles(t) {
+			if isChanged[filepath.Clean(file)] {
+				affected = append(affected, t)
+				break
+			}
+		}
+	}
+	return affected
+}
@@ -0,0 +1,77 @@
+package test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWatcherChanged(t *testing.T) {
+	dir := t.TempDir()
+	sql := filepath.Join(dir, "query.sql")
+	csv := filepath.Join(dir, "in.csv")
+	assert.Nil(t, os.WriteFile(sql, []byte("select 1"), 0644))
+	assert.Nil(t, os.WriteFile(csv, []byte("a\n1\n"), 0644))
+
+	watcher := NewWatcher()
+	assert.Equal(t, []string{csv, sql}, watcher.Changed([]string{sql, csv}))
+	assert.Equal(t, []string{}, watcher.Changed([]string{sql, csv}))
+
+	later := time.Now().Add(time.Minute)
+	assert.Nil(t, os.Chtimes(csv, later, later))
+	assert.Equal(t, []string{csv}, watcher.Changed([]string{sql, csv}))
+
+	// A file no longer watched counts as changed once
+	assert.Equal(t, []string{csv}, watcher.Changed([]string{sql}))
+	assert.Equal(t, []string{}, watcher.Changed([]string{sql}))
+}
+
+func TestWatcherAdd(t *testing.T) {
+	dir := t.TempDir()
+	sql := filepath.Join(dir, "query.sql")
+	csv := filepath.Join(dir, "in.csv")
+	assert.Nil(t, os.WriteFile(sql, []byte("select 1"), 0644))
+	assert.Nil(t, os.WriteFile(csv, []byte("a\n1\n"), 0644))
+
+	watcher := NewWatcher()
+	assert.Equal(t, []string{sql}, watcher.Changed([]string{sql}))
+
+	// An edit made before the new file is added is still reported
+	later := time.Now().Add(time.Minute)
+	assert.Nil(t, os.Chtimes(sql, later, later))
+	watcher.Add([]string{sql, csv})
+	assert.Equal(t, []string{sql}, watcher.Changed([]string{sql, csv}))
+}
+
+func TestWatchedFiles(t *testing.T) {
+	dir := t.TempDir()
+	definition := filepath.Join(dir, "broken.yaml")
+	content := "name: broken\nfile: models/a.sql\nmocks:\n  t:\n    filepath: tests/in.csv\noutput:\n  filepath: tests/out.csv\n"
+	assert.Nil(t, os.WriteFile(definition, []byte(content), 0644))
+
+	// The files of a definition that does not parse are watched from its raw YAML
+	files, err := WatchedFiles(dir, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{definition, "models/a.sql", "tests/in.csv", "tests/out.csv"}, files)
+}
+
+func TestAffectedTests(t *testing.T) {
+	tests := []Test{
+		{Name: "a", SourceFile: "tests/a.yaml", File: "models/a.sql", Mocks: map[string]Mock{"t": {Filepath: "tests/in.csv"}}},
+		{Name: "b", SourceFile: "tests/b.yaml", File: "models/b.sql", Output: Mock{Filepath: "tests/out.csv"}},
+	}
+	names := func(tests []Test) []string {
+		names := []string{}
+		for _, t := range tests {
+			names = append(names, t.Name)
+		}
+		return names
+	}
+	assert.Equal(t, []string{"a"}, names(AffectedTests(tests, []string{"tests/in.csv"})))
+	assert.Equal(t, []string{"b"}, names(AffectedTests(tests, []string{"./models/b.sql"})))
+	assert.Equal(t, []string{"a", "b"}, names(AffectedTests(tests, []string{"tests/a.yaml", "tests/out.csv"})))
+	assert.Equal(t, []string{}, names(AffectedTests(tests, []string{"tests/other.csv"})))
+}
@@ -0,0 +1,79 @@
+package test
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Returns whether a table name is a wildcard table such as `ds.events_*`
+func isWildcardTable(tableFullName string) bool {
+	return strings.HasSuffix(normalizeTableName(tableFullName), "*")
+}
+
+/*
+Returns the _TABLE_SUFFIX of a shard of a wildcard table, and whether the table is one of its shards.
+events_20240101 is a shard of events_* with the suffix 20240101
+*/
+func shardSuffix(wildcard string, tableFullName string) (string, bool) {
+	prefix := strings.TrimSuffix(normalizeTableName(wildcard), "*")
+	name := normalizeTableName(tableFullName)
+	if !isWildcardTable(wildcard) || isWildcardTable(name) || !strings.HasPrefix(name, prefix) {
+		return "", false
+	}
+	return strings.TrimPrefix(name, prefix), true
+}
+
+// Returns the tables that are shards of a wildcard table, sorted
+func wildcardShards(wildcard string, tableNames []string) []string {
+	shards := []string{}
+	for _, name := range tableNames {
+		if _, ok := shardSuffix(wildcard, name); ok {
+			shards = append(shards, name)
+		}
+	}
+	sort.Strings(shards)
+	return shards
+}
+
+// Returns whether a table is a shard of one of the wildcard tables a query reads
+func readByWildcard(tableFullName string, tables []string) bool {
+	for _, table := range tables {
+		if _, ok := shardSuffix(table, tableFullName); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// A shard of a wildcard table read from the CTE of its mock
+type wildcardShard struct {
+	Suffix  string
+	Cte     string
+	Columns []string
+}
+
+/*
+Returns the rows of a wildcard table, the rows of all its shards with their suffix as the _TABLE_SUFFIX pseudo-column.
+Every shard must have the same columns
+*/
+func wildcardSql(wildcard string, shards []wildcardShard) (string, error) {
+	if len(shards) == 0 {
+		return "", fmt.Errorf("wildcard table %v has no shards", wildcard)
+	}
+	columns := shards[0].Columns
+	sortedColumns := append([]string{}, columns...)
+	sort.Strings(sortedColumns)
+	selects := []string{}
+	for _, shard := range shards {
+		shardColumns := append([]string{}, shard.Columns...)
+		sort.Strings(shardColumns)
+		if strings.Join(shardColumns, ",") != strings.Join(sortedColumns, ",") {
+			return "", fmt.Errorf("shards of wildcard table %v have different columns: %s and %s",
+				wildcard, strings.Join(sortedColumns, ", "), strings.Join(shardColumns, ", "))
+		}
+		selects = append(selects, fmt.Sprintf("\n SELECT %s, '%s' AS _TABLE_SUFFIX FROM %s",
+			strings.Join(columns, ", "), shard.Suffix, shard.Cte))
+	}
+	return strings.Join(selects, "\n UNION ALL \n"), nil
+}
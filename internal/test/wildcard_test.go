@@ -0,0 +1,38 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShardSuffix(t *testing.T) {
+	suffix, ok := shardSuffix("`proj.ds.events_*`", "`proj`.`ds`.`events_20240101`")
+	assert.True(t, ok)
+	assert.Equal(t, "20240101", suffix)
+
+	_, ok = shardSuffix("proj.ds.events_*", "proj.ds.sessions_20240101")
+	assert.False(t, ok)
+	_, ok = shardSuffix("proj.ds.events_20240101", "proj.ds.events_20240101")
+	assert.False(t, ok)
+
+	assert.Equal(t, []string{"ds.events_20240101", "ds.events_20240102"},
+		wildcardShards("ds.events_*", []string{"ds.events_20240102", "ds.users", "ds.events_20240101"}))
+	assert.True(t, readByWildcard("ds.events_20240101", []string{"ds.users", "ds.events_*"}))
+	assert.False(t, readByWildcard("ds.events_20240101", []string{"ds.users"}))
+}
+
+func TestWildcardSql(t *testing.T) {
+	rows, err := wildcardSql("ds.events_*", []wildcardShard{
+		{Suffix: "20240101", Cte: "bqt_mock_1", Columns: []string{"id", "name"}},
+		{Suffix: "20240102", Cte: "bqt_mock_2", Columns: []string{"name", "id"}},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "\n SELECT id, name, '20240101' AS _TABLE_SUFFIX FROM bqt_mock_1\n UNION ALL \n\n SELECT id, name, '20240102' AS _TABLE_SUFFIX FROM bqt_mock_2", rows)
+
+	_, err = wildcardSql("ds.events_*", []wildcardShard{
+		{Suffix: "20240101", Cte: "bqt_mock_1", Columns: []string{"id"}},
+		{Suffix: "20240102", Cte: "bqt_mock_2", Columns: []string{"id", "name"}},
+	})
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,4 @@
+SELECT
+    category
+  FROM mytable
+  WHERE price > 10
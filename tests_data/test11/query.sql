@@ -0,0 +1,5 @@
+SELECT
+    id,
+    price
+  FROM mytable
+  ORDER BY price DESC
@@ -0,0 +1,5 @@
+SELECT
+    category,
+    AVG(price) AS avg_price
+  FROM mytable
+  GROUP BY category
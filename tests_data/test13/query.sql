@@ -0,0 +1,5 @@
+SELECT
+    e.event_id,
+    ARRAY(SELECT item.id FROM UNNEST(e.items) AS item ORDER BY item.id) AS item_ids,
+    ARRAY(SELECT tag FROM UNNEST(e.items) AS item, UNNEST(item.tags) AS tag) AS tags
+  FROM `analytics`.`events` e
@@ -0,0 +1,4 @@
+SELECT
+    COUNT(*) AS order_count,
+    IFNULL(SUM(amount), 0) AS total_amount
+  FROM `shop`.`orders`
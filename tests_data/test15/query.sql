@@ -0,0 +1,4 @@
+SELECT
+    order_id,
+    IF(amount < 0, ERROR(CONCAT('negative amount for order ', CAST(order_id AS STRING))), amount) AS amount
+  FROM `shop`.`orders`
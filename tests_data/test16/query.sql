@@ -0,0 +1,5 @@
+SELECT order_id, amount
+  FROM `shop`.`orders`
+  WHERE order_date = @run_date
+    AND status IN UNNEST(@statuses)
+    AND amount >= @min_amount
@@ -0,0 +1,7 @@
+SELECT o.order_id, c.name
+  FROM {{ ref('orders') }} o
+  JOIN {{ source('crm', 'customers') }} c ON c.id = o.customer_id
+  WHERE o.order_date >= '{{ var('start') }}'
+  {{- if .exclude_test_accounts }}
+    AND NOT c.is_test
+  {{- end }}
@@ -0,0 +1,3 @@
+SELECT customer_id, SUM(amount) AS total
+  FROM `shop`.`orders`
+  GROUP BY customer_id
@@ -0,0 +1,4 @@
+SELECT _TABLE_SUFFIX AS day, COUNT(*) AS events
+  FROM `shop.analytics.events_*`
+  WHERE _TABLE_SUFFIX BETWEEN '20240101' AND '20240102'
+  GROUP BY day
@@ -0,0 +1,12 @@
+DECLARE run_date DATE DEFAULT DATE '2024-01-31';
+
+CREATE TEMP TABLE changed AS
+  SELECT id, name FROM `staging`.`customers` WHERE updated_on = run_date;
+
+MERGE `crm`.`customers` c
+USING changed s
+ON c.id = s.id
+WHEN MATCHED THEN UPDATE SET name = s.name
+WHEN NOT MATCHED THEN INSERT (id, name) VALUES (s.id, s.name);
+
+DELETE FROM `crm`.`customers` WHERE name IS NULL;
@@ -0,0 +1,5 @@
+SELECT
+    id,
+    UPPER(name) AS upper_name,
+    LENGTH(name) AS name_length
+  FROM mytable
@@ -0,0 +1,6 @@
+SELECT
+    o.order_id,
+    c.name,
+    o.amount * 2 AS double_amount
+  FROM `shop`.`orders` o
+  JOIN `shop`.`customers` c ON o.customer_id = c.id